@@ -0,0 +1,97 @@
+package ssdeep
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Result is the outcome of hashing one file of a batch.
+type Result struct {
+	// Path is the path of the hashed file.
+	Path string
+	// Hash is the fuzzy hash of the file, empty when Err is set.
+	Hash string
+	// Err is the error that prevented the file from being hashed, if any.
+	Err error
+}
+
+// FuzzyFileList hashes the files listed in the text file at listPath, one path per line,
+// using up to concurrency goroutines. Blank lines and lines starting with # are skipped.
+// Results are sent in completion order, not list order, and the channel is closed once
+// every listed file has been processed. A failure to read the list itself is reported
+// as a last Result whose Path is listPath.
+// Canceling ctx stops the batch: the files not hashed yet are skipped, the results not
+// received yet are dropped and the channel is closed, so a caller may stop receiving
+// once it has canceled ctx.
+// Returns an error when the list file could not be opened.
+func FuzzyFileList(ctx context.Context, listPath string, concurrency int) (<-chan Result, error) {
+	f, err := os.Open(listPath)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(chan string)
+	var listErr error
+	go func() {
+		defer f.Close()
+		defer close(paths)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			select {
+			case paths <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		listErr = scanner.Err()
+	}()
+
+	results := make(chan Result)
+	go func() {
+		defer close(results)
+		hashFiles(ctx, paths, results, concurrency)
+		// Once canceled, the workers may return before the list is read: drain it so
+		// that the reader returns, and wait for it to set listErr.
+		for range paths {
+		}
+		if listErr != nil {
+			select {
+			case results <- Result{Path: listPath, Err: listErr}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return results, nil
+}
+
+// hashFiles hashes the files received on paths with up to concurrency goroutines and
+// sends their results, returning once paths is closed and every file is processed, or
+// once ctx is done, dropping the results not sent yet.
+func hashFiles(ctx context.Context, paths <-chan string, results chan<- Result, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				h, err := FuzzyFilename(path)
+				select {
+				case results <- Result{Path: path, Hash: h, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
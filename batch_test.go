@@ -0,0 +1,67 @@
+package ssdeep
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFuzzyFileList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssdeep")
+	assertNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	listPath := filepath.Join(dir, "list.txt")
+	list := "# files to hash\n\nssdeep_results.json\n  LICENSE  \nfoo.bar\n"
+	assertNoError(t, ioutil.WriteFile(listPath, []byte(list), 0600))
+
+	results, err := FuzzyFileList(context.Background(), listPath, 2)
+	assertNoError(t, err)
+	byPath := make(map[string]Result)
+	for r := range results {
+		byPath[r.Path] = r
+	}
+	if len(byPath) != 3 {
+		t.Fatalf("Expected 3 results, got %+v", byPath)
+	}
+	assertHashEqual(t, "1536:74peLhFipssVfuInITTTZzMoW0379xy3u:VVFosEfudTj579k3u", byPath["ssdeep_results.json"].Hash)
+	assertNoError(t, byPath["ssdeep_results.json"].Err)
+	if byPath["LICENSE"].Err != ErrSmallInput {
+		t.Errorf("Expected ErrSmallInput for LICENSE, got %v", byPath["LICENSE"].Err)
+	}
+	assertError(t, byPath["foo.bar"].Err)
+
+	_, err = FuzzyFileList(context.Background(), filepath.Join(dir, "missing.txt"), 2)
+	assertError(t, err)
+}
+
+func TestFuzzyFileListCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssdeep")
+	assertNoError(t, err)
+	defer os.RemoveAll(dir)
+	listPath := filepath.Join(dir, "list.txt")
+	list := strings.Repeat("ssdeep_results.json\n", 50)
+	assertNoError(t, ioutil.WriteFile(listPath, []byte(list), 0600))
+
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := FuzzyFileList(ctx, listPath, 4)
+	assertNoError(t, err)
+	<-results
+	cancel()
+	// Even if the caller stops receiving, every goroutine exits.
+	for i := 0; i < 500 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("Leaked goroutines: %d before, %d after", before, n)
+	}
+	if _, ok := <-results; ok {
+		t.Fatal("Results channel not closed after cancellation")
+	}
+}
@@ -0,0 +1,163 @@
+package ssdeep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// checkpointInterval is the number of bytes hashed between two checkpoints.
+var checkpointInterval int64 = 64 << 20
+
+// checkpointMagic starts a checkpoint file and identifies its layout.
+const checkpointMagic = "ssdc\x01"
+
+// checkpointFile identifies the file a checkpoint was written for.
+type checkpointFile struct {
+	path  string
+	size  int64
+	mtime int64
+}
+
+// FuzzyFileCheckpointed computes the fuzzy hash of the file at path like FuzzyFilename,
+// periodically saving its progress to checkpointPath so that an interrupted run can be
+// resumed by calling it again with the same arguments.
+// The file is read once, whatever the number of times the block size is halved.
+// A checkpoint is written every 64 MiB hashed, replacing the previous one atomically,
+// and it is removed once the hash is computed. A checkpoint left by another file, or by
+// the same file before it was modified, is told apart by the path, the size and the
+// modification time of the file, and ignored: hashing starts over.
+// It is the caller's responsibility to append the filename to the result after computation.
+// Returns an error when the file or the checkpoint could not be read, the checkpoint
+// could not be written, or ssdeep could not be computed on the file.
+func FuzzyFileCheckpointed(path, checkpointPath string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := stat.Size()
+	if size < minFileSize {
+		return "", ErrSmallInput
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	file := checkpointFile{path: abs, size: size, mtime: stat.ModTime().UnixNano()}
+
+	d := newSizedDigest(size)
+	data, err := ioutil.ReadFile(checkpointPath)
+	switch {
+	case err == nil:
+		saved, digest, err := readCheckpoint(data)
+		if err != nil {
+			return "", err
+		}
+		if saved == file {
+			var restored Digest
+			if err := restored.UnmarshalBinary(digest); err != nil {
+				return "", err
+			}
+			if restored.sizeHint != size || restored.Size() > size {
+				return "", ErrInvalidState
+			}
+			d = &restored
+		}
+	case !os.IsNotExist(err):
+		return "", err
+	}
+
+	if _, err := f.Seek(d.Size(), io.SeekStart); err != nil {
+		return "", err
+	}
+	for d.Size() < size {
+		n := checkpointInterval - d.Size()%checkpointInterval
+		if n > size-d.Size() {
+			n = size - d.Size()
+		}
+		if _, err := io.CopyN(d, f, n); err != nil {
+			return "", err
+		}
+		if d.Size() < size {
+			if err := writeCheckpoint(checkpointPath, file, d); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	result, err := d.Sum()
+	if err != nil {
+		return "", err
+	}
+	if err := os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return result, nil
+}
+
+// writeCheckpoint saves the identity of the file and the digest of the data hashed so
+// far, writing to a temporary file first so that a crash never leaves a partial
+// checkpoint.
+func writeCheckpoint(path string, file checkpointFile, d *Digest) error {
+	digest, err := d.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(checkpointMagic)
+	binary.Write(&buf, binary.BigEndian, file.size)
+	binary.Write(&buf, binary.BigEndian, file.mtime)
+	binary.Write(&buf, binary.BigEndian, uint32(len(file.path)))
+	buf.WriteString(file.path)
+	buf.Write(digest)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readCheckpoint decodes a checkpoint written by writeCheckpoint into the identity of
+// the file and the encoding of the digest.
+// Returns ErrInvalidState when data is not a checkpoint.
+func readCheckpoint(data []byte) (checkpointFile, []byte, error) {
+	if !bytes.HasPrefix(data, []byte(checkpointMagic)) {
+		return checkpointFile{}, nil, ErrInvalidState
+	}
+	r := bytes.NewReader(data[len(checkpointMagic):])
+	var file checkpointFile
+	var n uint32
+	for _, v := range []interface{}{&file.size, &file.mtime, &n} {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return checkpointFile{}, nil, ErrInvalidState
+		}
+	}
+	if int64(n) > int64(r.Len()) {
+		return checkpointFile{}, nil, ErrInvalidState
+	}
+	path := make([]byte, n)
+	if _, err := io.ReadFull(r, path); err != nil {
+		return checkpointFile{}, nil, ErrInvalidState
+	}
+	file.path = string(path)
+	return file, data[len(data)-r.Len():], nil
+}
@@ -0,0 +1,82 @@
+package ssdeep
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFuzzyFileCheckpointed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssdeep")
+	assertNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	blob := make([]byte, 500000)
+	rand.Read(blob)
+	path := filepath.Join(dir, "data")
+	assertNoError(t, ioutil.WriteFile(path, blob, 0600))
+	checkpointPath := filepath.Join(dir, "checkpoint")
+	expected, err := FuzzyBytes(blob)
+	assertNoError(t, err)
+
+	defer func(interval int64) { checkpointInterval = interval }(checkpointInterval)
+	checkpointInterval = 4096
+	result, err := FuzzyFileCheckpointed(path, checkpointPath)
+	assertNoError(t, err)
+	assertHashEqual(t, expected, result)
+	if _, err := os.Stat(checkpointPath); !os.IsNotExist(err) {
+		t.Fatal("Checkpoint should be removed once the hash is computed")
+	}
+
+	stat, err := os.Stat(path)
+	assertNoError(t, err)
+	abs, err := filepath.Abs(path)
+	assertNoError(t, err)
+	file := checkpointFile{path: abs, size: stat.Size(), mtime: stat.ModTime().UnixNano()}
+
+	// Simulate a run interrupted halfway through.
+	d := newSizedDigest(int64(len(blob)))
+	d.Write(blob[:len(blob)/2])
+	assertNoError(t, writeCheckpoint(checkpointPath, file, d))
+	result, err = FuzzyFileCheckpointed(path, checkpointPath)
+	assertNoError(t, err)
+	assertHashEqual(t, expected, result)
+
+	// A checkpoint resumes from the data it has hashed, whatever that data: one left
+	// by another file of the same size, or by the same file before it was modified,
+	// would give a wrong hash and must be ignored.
+	other := newSizedDigest(int64(len(blob)))
+	other.Write(make([]byte, len(blob)/2))
+	for _, f := range []checkpointFile{
+		{path: abs + ".other", size: file.size, mtime: file.mtime},
+		{path: abs, size: file.size, mtime: file.mtime - int64(time.Second)},
+		{path: abs, size: 42, mtime: file.mtime},
+	} {
+		assertNoError(t, writeCheckpoint(checkpointPath, f, other))
+		result, err = FuzzyFileCheckpointed(path, checkpointPath)
+		assertNoError(t, err)
+		assertHashEqual(t, expected, result)
+	}
+
+	assertNoError(t, ioutil.WriteFile(checkpointPath, []byte("garbage"), 0600))
+	_, err = FuzzyFileCheckpointed(path, checkpointPath)
+	assertError(t, err)
+
+	assertNoError(t, writeCheckpoint(checkpointPath, file, d))
+	data, err := ioutil.ReadFile(checkpointPath)
+	assertNoError(t, err)
+	saved, _, err := readCheckpoint(data)
+	assertNoError(t, err)
+	if saved != file {
+		t.Fatalf("%+v (expected) != %+v (actual)", file, saved)
+	}
+	header := len(checkpointMagic) + 8 + 8 + 4 + len(abs)
+	for i := 0; i < header; i++ {
+		if _, _, err := readCheckpoint(data[:i]); err != ErrInvalidState {
+			t.Fatalf("Checkpoint truncated to %d bytes: expected ErrInvalidState, got %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package ssdeep
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// ClusterOption configures Cluster.
+type ClusterOption func(*clusterOptions)
+
+type clusterOptions struct {
+	workers int
+}
+
+// ClusterWorkers makes Cluster compare the hashes with n goroutines instead of one, or
+// with one goroutine per CPU when n is zero or less.
+func ClusterWorkers(n int) ClusterOption {
+	return func(o *clusterOptions) {
+		o.workers = n
+	}
+}
+
+// Cluster groups hashes into families by single-linkage clustering: two hashes are in
+// the same cluster when a chain of hashes links them, each pair along the chain having
+// a match score of at least threshold. A zero score never links hashes.
+// Only the pairs sharing a 7-character substring at a common block size are compared,
+// as a Matcher would, rather than every pair.
+// Clusters are returned as the indexes of their hashes in increasing order, ordered by
+// their first index; hashes matching no other one are returned as clusters of their own.
+// Returns an error when one of the hashes is not a valid signature.
+func Cluster(hashes []string, threshold int, opts ...ClusterOption) ([][]int, error) {
+	o := clusterOptions{workers: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.workers < 1 {
+		o.workers = runtime.NumCPU()
+	}
+
+	// Hashes identical once sequences are eliminated score 100: they are linked upfront,
+	// and only the first of them is compared to the other hashes.
+	parsed := make([]Hash, len(hashes))
+	first := make(map[Hash]int)
+	var unique []int
+	var duplicates [][2]int
+	store := NewMemoryStore()
+	for i, s := range hashes {
+		h, err := ParseHash(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed[i] = h
+		if j, ok := first[h.EliminateSequences()]; ok {
+			if threshold <= 100 {
+				duplicates = append(duplicates, [2]int{j, i})
+			}
+			continue
+		}
+		first[h.EliminateSequences()] = i
+		unique = append(unique, i)
+		store.Put(strconv.Itoa(i), h)
+	}
+
+	// Each worker collects the links of the hashes it is given with the hashes after them.
+	next := make(chan int)
+	links := make([][][2]int, o.workers+1)
+	links[o.workers] = duplicates
+	var wg sync.WaitGroup
+	wg.Add(o.workers)
+	for w := 0; w < o.workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := range next {
+				ids, _ := store.Candidates(parsed[i])
+				for _, id := range ids {
+					j, _ := strconv.Atoi(id)
+					if j <= i {
+						continue
+					}
+					if score := compare(parsed[i], parsed[j]); score > 0 && score >= threshold {
+						links[w] = append(links[w], [2]int{i, j})
+					}
+				}
+			}
+		}(w)
+	}
+	for _, i := range unique {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	parent := make([]int, len(hashes))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for _, l := range links {
+		for _, link := range l {
+			a, b := find(link[0]), find(link[1])
+			// Keep the smallest index as the root, so clusters come out in order.
+			if a < b {
+				parent[b] = a
+			} else if b < a {
+				parent[a] = b
+			}
+		}
+	}
+
+	var clusters [][]int
+	index := make(map[int]int)
+	for i := range parsed {
+		root := find(i)
+		c, ok := index[root]
+		if !ok {
+			c = len(clusters)
+			index[root] = c
+			clusters = append(clusters, nil)
+		}
+		clusters[c] = append(clusters[c], i)
+	}
+	return clusters, nil
+}
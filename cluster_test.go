@@ -0,0 +1,65 @@
+package ssdeep
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestCluster(t *testing.T) {
+	hashes := []string{h3, h1, "3:abc:def", h4, h2}
+	expected := [][]int{{0, 3}, {1, 4}, {2}}
+	for _, workers := range []int{1, 4, 0} {
+		clusters, err := Cluster(hashes, 30, ClusterWorkers(workers))
+		assertNoError(t, err)
+		if !reflect.DeepEqual(expected, clusters) {
+			t.Fatalf("Clusters mismatch: %v (expected) != %v (actual)", expected, clusters)
+		}
+	}
+
+	// h1 and h2 only score 35.
+	clusters, err := Cluster(hashes, 50)
+	assertNoError(t, err)
+	expected = [][]int{{0, 3}, {1}, {2}, {4}}
+	if !reflect.DeepEqual(expected, clusters) {
+		t.Fatalf("Clusters mismatch: %v (expected) != %v (actual)", expected, clusters)
+	}
+
+	// Identical hashes too short to share a substring, and hashes differing only by the
+	// length of their runs, score 100.
+	clusters, err = Cluster([]string{"3:abcdefff:abc", h1, "3:abcdefff:abc", "3:abcdefffff:abc", h1}, 50)
+	assertNoError(t, err)
+	expected = [][]int{{0, 2, 3}, {1, 4}}
+	if !reflect.DeepEqual(expected, clusters) {
+		t.Fatalf("Clusters mismatch: %v (expected) != %v (actual)", expected, clusters)
+	}
+
+	_, err = Cluster([]string{h1, "5:abc:def"}, 50)
+	assertError(t, err)
+}
+
+func TestClusterSingleLinkage(t *testing.T) {
+	// Each file is a small edit of the previous one: the first and last ones are too
+	// far apart to match directly, but the chain links them.
+	r := rand.New(rand.NewSource(1))
+	blob := make([]byte, 20000)
+	r.Read(blob)
+	var hashes []string
+	for i := 0; i < 6; i++ {
+		h, err := FuzzyBytes(blob)
+		assertNoError(t, err)
+		hashes = append(hashes, h)
+		r.Read(blob[i*3000 : i*3000+3000])
+	}
+	first, err := Compare(hashes[0], hashes[5])
+	assertNoError(t, err)
+	if first >= 50 {
+		t.Skipf("First and last hashes match directly (%d)", first)
+	}
+	clusters, err := Cluster(hashes, 50, ClusterWorkers(0))
+	assertNoError(t, err)
+	expected := [][]int{{0, 1, 2, 3, 4, 5}}
+	if !reflect.DeepEqual(expected, clusters) {
+		t.Fatalf("Clusters mismatch: %v (expected) != %v (actual)", expected, clusters)
+	}
+}
@@ -0,0 +1,180 @@
+// Command ssdeep computes fuzzy hashes of files and matches them against known hashes,
+// with the same output as the ssdeep tool.
+//
+// Usage:
+//
+//	ssdeep [-V] [-r] [-s] [-m known.txt [-c] [-t threshold]] FILES...
+//
+// Without -m, the hashes of FILES are printed in the ssdeep format, starting with the
+// ssdeep,1.1--blocksize:hash:hash,filename header. With -m, each file is matched against
+// the hashes of known.txt, a file in that same format.
+//
+// The exit code is 0 on success, 1 when a file could not be hashed, the known hashes
+// could not be read or the output could not be written, and 2 on invalid usage. Finding no match is not an error.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chennqqi/ssdeep"
+)
+
+// VERSION and BUILDDATE are set at build time by the Makefile.
+var (
+	VERSION   = "ssdeep version devel"
+	BUILDDATE = ""
+)
+
+const (
+	exitSuccess = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ssdeep", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	recursive := flags.Bool("r", false, "recursive mode, hash the files of directories and their subdirectories")
+	matchFile := flags.String("m", "", "match FILES against the known hashes of `file`")
+	csv := flags.Bool("c", false, "print matches in CSV format")
+	threshold := flags.Int("t", 0, "only print matches scoring above `threshold`")
+	silent := flags.Bool("s", false, "silent mode, do not print errors")
+	version := flags.Bool("V", false, "print the version and exit")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *version {
+		if _, err := fmt.Fprintln(stdout, strings.TrimSpace(VERSION+" "+BUILDDATE)); err != nil {
+			fmt.Fprintf(stderr, "ssdeep: %v\n", err)
+			return exitFailure
+		}
+		return exitSuccess
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "ssdeep: no input files")
+		flags.Usage()
+		return exitUsage
+	}
+
+	status := exitSuccess
+	report := func(path string, err error) {
+		status = exitFailure
+		if pe, ok := err.(*os.PathError); ok {
+			// The path is already printed.
+			err = pe.Err
+		}
+		if !*silent {
+			fmt.Fprintf(stderr, "ssdeep: %s: %v\n", path, err)
+		}
+	}
+	// Once the output fails, the files left are not hashed: their results would be lost.
+	var writeErr error
+	write := func(err error) {
+		if err == nil {
+			return
+		}
+		writeErr = err
+		status = exitFailure
+		if !*silent {
+			fmt.Fprintf(stderr, "ssdeep: %v\n", err)
+		}
+	}
+
+	var index *ssdeep.Index
+	if *matchFile != "" {
+		known, err := ssdeep.ReadHashFile(*matchFile)
+		if err != nil {
+			report(*matchFile, err)
+			return status
+		}
+		index = ssdeep.NewIndex()
+		for i := range known {
+			index.Add(known[i].Hash().String(), known[i].Filename())
+		}
+	}
+
+	w := ssdeep.NewFileWriter(stdout)
+	hash := func(path string) {
+		if writeErr != nil {
+			return
+		}
+		h, err := hashFile(path)
+		if err != nil {
+			report(path, err)
+			return
+		}
+		if index == nil {
+			write(w.WriteHash(h, path))
+			return
+		}
+		matches, err := index.Match(h, *threshold+1)
+		if err != nil {
+			report(path, err)
+			return
+		}
+		for _, m := range matches {
+			known := *matchFile + ":" + m.ID
+			if *csv {
+				_, err = fmt.Fprintf(stdout, "%s,%s,%d\n", ssdeep.QuoteFilename(path), ssdeep.QuoteFilename(known), m.Score)
+			} else {
+				_, err = fmt.Fprintf(stdout, "%s matches %s (%d)\n", path, known, m.Score)
+			}
+			if err != nil {
+				write(err)
+				return
+			}
+		}
+	}
+
+	for _, path := range flags.Args() {
+		info, err := os.Stat(path)
+		if err != nil {
+			report(path, err)
+			continue
+		}
+		if !info.IsDir() {
+			hash(path)
+			continue
+		}
+		if !*recursive {
+			report(path, errors.New("is a directory"))
+			continue
+		}
+		filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				report(p, err)
+				return nil
+			}
+			if info.Mode().IsRegular() {
+				hash(p)
+			}
+			return nil
+		})
+	}
+	return status
+}
+
+// hashFile computes the fuzzy hash of the file at path. Like ssdeep, files smaller than
+// the minimum size of the library are hashed too.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return ssdeep.FuzzyReaderOptions(f, info.Size(), ssdeep.Options{AllowSmall: true})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssdeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	blob := make([]byte, 20000)
+	rand.Read(blob)
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "sub", `b "quoted"`)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	for _, path := range []string{a, b} {
+		if err := ioutil.WriteFile(path, blob, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-r", dir}, &stdout, &stderr); code != exitSuccess {
+		t.Fatalf("Exit code %d: %s", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || lines[0] != "ssdeep,1.1--blocksize:hash:hash,filename" {
+		t.Fatalf("Unexpected output: %q", stdout.String())
+	}
+	if !strings.HasSuffix(lines[2], `,"`+filepath.Join(dir, "sub", `b \"quoted\"`)+`"`) {
+		t.Fatalf("Filename not escaped: %s", lines[2])
+	}
+	known := filepath.Join(dir, "known.txt")
+	if err := ioutil.WriteFile(known, stdout.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"-m", known, a}, &stdout, &stderr); code != exitSuccess {
+		t.Fatalf("Exit code %d: %s", code, stderr.String())
+	}
+	expected := a + " matches " + known + ":" + a + " (100)\n" +
+		a + " matches " + known + ":" + b + " (100)\n"
+	if stdout.String() != expected {
+		t.Fatalf("Unexpected matches: %q", stdout.String())
+	}
+
+	stdout.Reset()
+	run([]string{"-c", "-m", known, a}, &stdout, &stderr)
+	if !strings.HasPrefix(stdout.String(), `"`+a+`","`+known+":"+a+`",100`+"\n") {
+		t.Fatalf("Unexpected CSV matches: %q", stdout.String())
+	}
+
+	stderr.Reset()
+	if code := run([]string{dir, filepath.Join(dir, "missing")}, &stdout, &stderr); code != exitFailure {
+		t.Fatalf("Expected exit code %d, got %d", exitFailure, code)
+	}
+	if strings.Count(stderr.String(), "\n") != 2 {
+		t.Fatalf("Expected two errors, got %q", stderr.String())
+	}
+	if code := run(nil, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("Expected exit code %d, got %d", exitUsage, code)
+	}
+}
+
+// failingWriter fails every write, as a closed pipe does.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestRunWriteError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssdeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	blob := make([]byte, 20000)
+	rand.Read(blob)
+	a := filepath.Join(dir, "a")
+	if err := ioutil.WriteFile(a, blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var known bytes.Buffer
+	if code := run([]string{a}, &known, ioutil.Discard); code != exitSuccess {
+		t.Fatalf("Exit code %d", code)
+	}
+	knownPath := filepath.Join(dir, "known.txt")
+	if err := ioutil.WriteFile(knownPath, known.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{a, a},
+		{"-m", knownPath, a, a},
+		{"-c", "-m", knownPath, a, a},
+		{"-V"},
+	} {
+		var stderr bytes.Buffer
+		if code := run(args, failingWriter{}, &stderr); code != exitFailure {
+			t.Errorf("%q: expected exit code %d, got %d", args, exitFailure, code)
+		}
+		if stderr.String() != "ssdeep: broken pipe\n" {
+			t.Errorf("%q: unexpected errors %q", args, stderr.String())
+		}
+	}
+}
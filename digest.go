@@ -0,0 +1,181 @@
+package ssdeep
+
+// maxBlockSizes bounds the number of block sizes a Digest tracks, from blockMin up to
+// blockMin << (maxBlockSizes - 1), enough for inputs of several petabytes.
+const maxBlockSizes = 48
+
+// Digest computes the fuzzy hash of a stream in a single pass, without knowing its size
+// in advance nor seeking back into it. Data is added with Write and the hash is read
+// with Sum.
+//
+// Where the block size derived from the input size gives too short a signature, ssdeep
+// halves the block size and starts over. Instead, Digest computes the signatures at
+// every candidate block size at once, and picks the one ssdeep would have settled on
+// when Sum is called. Like libfuzzy, it only starts tracking a block size once the block
+// size below it hits its first boundary, and stops tracking block sizes that can no
+// longer be picked, so that only a handful of block sizes are updated for each byte.
+// A Digest does not allocate once created.
+type Digest struct {
+	rollingState rollingState
+	size         int64
+	// sizeHint is the size of the input when known in advance, or zero.
+	sizeHint int64
+	// blocks[i] tracks block size blockMin << i, for start <= i < end.
+	blocks [maxBlockSizes]blockState
+	start  int
+	end    int
+	// limit bounds end: larger block sizes can never be picked.
+	limit int
+}
+
+// New returns a new Digest. As it never seeks back into its input, it can hash data
+// arriving from a network connection or a pipe, whose size is not known in advance.
+func New() *Digest {
+	d := &Digest{}
+	d.Reset()
+	return d
+}
+
+// newSizedDigest returns a Digest for an input of the given size. It gives the hashes
+// FuzzyReader gives for that size, and only tracks the block sizes up to the one derived
+// from the size, as the block size is only ever halved from there.
+func newSizedDigest(size int64) *Digest {
+	d := New()
+	d.sizeHint = size
+	state := newSsdeepState()
+	state.getBlockSize(size)
+	d.limit = 0
+	for blockMin<<uint(d.limit) < state.blockSize {
+		d.limit++
+	}
+	d.limit++
+	return d
+}
+
+// Reset discards the data written so far.
+func (d *Digest) Reset() {
+	d.rollingState = rollingState{}
+	d.size = 0
+	d.blocks[0] = newBlockState()
+	d.start = 0
+	d.end = 1
+	d.limit = maxBlockSizes
+	d.sizeHint = 0
+}
+
+// Size returns the number of bytes written so far.
+func (d *Digest) Size() int64 {
+	return d.size
+}
+
+// Write adds p to the hashed data. It never returns an error.
+func (d *Digest) Write(p []byte) (int, error) {
+	blocks := d.blocks[d.start:d.end]
+	for _, c := range p {
+		d.size++
+		d.rollingState.roll(c)
+		for i := range blocks {
+			blocks[i].blockHash1 = sumHash(c, blocks[i].blockHash1)
+			blocks[i].blockHash2 = sumHash(c, blocks[i].blockHash2)
+		}
+		if rh := d.rollingState.rollSum(); isBoundary(rh, d.start) {
+			d.boundary(rh)
+			blocks = d.blocks[d.start:d.end]
+		}
+	}
+	return len(p), nil
+}
+
+// isBoundary reports whether rh, the value of the rolling hash, is at a boundary of block
+// size blockMin << n. It computes rh%blockSize == blockSize-1 without the division by the
+// block size, which would otherwise dominate the hashing time: the n low bits of rh must
+// all be set, and the remaining ones must be blockMin-1 modulo blockMin.
+func isBoundary(rh uint32, n int) bool {
+	if n >= 32 {
+		return false
+	}
+	mask := uint32(1)<<uint(n) - 1
+	return rh&mask == mask && (rh>>uint(n))%uint32(blockMin) == uint32(blockMin)-1
+}
+
+// boundary updates the block sizes having a boundary where the rolling hash is rh, given
+// the smallest block size tracked has one.
+func (d *Digest) boundary(rh uint32) {
+	// Boundaries of larger block sizes are boundaries of smaller ones too.
+	for i := d.start; i < d.end && isBoundary(rh, i); i++ {
+		b := &d.blocks[i]
+		if b.boundaries == 0 && i == d.end-1 && d.end < d.limit {
+			// The next block size has had no boundary yet either, so it has hashed
+			// exactly the same data: start tracking it from a copy.
+			d.blocks[d.end] = *b
+			d.end++
+		}
+		b.boundary(int64(rh), blockMin<<uint(i))
+	}
+	// Signatures only grow on boundaries, check whether the smallest block size
+	// can be dropped now.
+	d.tryReduce()
+}
+
+// inputSize returns the size the block size is derived from.
+func (d *Digest) inputSize() int64 {
+	if d.sizeHint > 0 {
+		return d.sizeHint
+	}
+	return d.size
+}
+
+// tryReduce stops tracking the smallest block size once it can no longer be picked: the
+// input is already too large for it to be the initial block size, and the next block
+// size has a long enough signature for the halving to stop there.
+func (d *Digest) tryReduce() {
+	for d.end-d.start > 2 {
+		blockSize := blockMin << uint(d.start)
+		if blockSize*spamSumLength >= d.inputSize() || d.blocks[d.start+1].len1 < spamSumLength/2 {
+			return
+		}
+		d.start++
+	}
+}
+
+// Sum returns the fuzzy hash of the data written so far, the same FuzzyReader would
+// compute on it. More data can be written after calling Sum.
+// Returns an error when ssdeep could not be computed on the data.
+func (d *Digest) Sum() (string, error) {
+	state, err := d.state(Options{})
+	if err != nil {
+		return "", err
+	}
+	return state.finalize(), nil
+}
+
+// state returns the state of the block size ssdeep settles on, adjusted by opts.
+func (d *Digest) state(opts Options) (ssdeepState, error) {
+	size := d.inputSize()
+	if size < minFileSize && !opts.AllowSmall {
+		return ssdeepState{}, ErrSmallInput
+	}
+	state := newSsdeepState()
+	state.getBlockSize(size)
+	i := d.start
+	for blockMin<<uint(i) < state.blockSize && i < d.end-1 {
+		i++
+	}
+	for ; i >= d.start; i-- {
+		if d.blocks[i].len1 >= spamSumLength/2 || opts.AllowSmall && i == 0 {
+			state.rollingState = d.rollingState
+			state.blockSize = blockMin << uint(i)
+			state.blockState = d.blocks[i]
+			state.eliminateSequences = opts.EliminateSequences
+			return state, nil
+		}
+	}
+	return ssdeepState{}, ErrSmallBlock
+}
+
+// String returns the fuzzy hash of the data written so far, or an empty string when it
+// could not be computed.
+func (d *Digest) String() string {
+	h, _ := d.Sum()
+	return h
+}
@@ -0,0 +1,193 @@
+package ssdeep
+
+import (
+	"bytes"
+	"encoding"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestDigestMatchesFuzzyBytes(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, size := range []int{4096, 4097, 6144, 6145, 20000, 100000, 1000000, 3*1024*1024 + 7} {
+		blob := make([]byte, size)
+		r.Read(blob)
+		expected, err := FuzzyBytes(blob)
+		assertNoError(t, err)
+
+		d := New()
+		d.Write(blob)
+		result, err := d.Sum()
+		assertNoError(t, err)
+		assertHashEqual(t, expected, result)
+	}
+}
+
+func TestDigestChunkedWrites(t *testing.T) {
+	f, err := os.Open("ssdeep_results.json")
+	assertNoError(t, err)
+	defer f.Close()
+
+	for _, chunkSize := range []int64{1, 7, 4096, 65536} {
+		_, err := f.Seek(0, io.SeekStart)
+		assertNoError(t, err)
+		d := New()
+		for {
+			n, err := io.CopyN(d, f, chunkSize)
+			if err == io.EOF {
+				break
+			}
+			assertNoError(t, err)
+			if n != chunkSize {
+				t.Fatalf("Short copy: %d", n)
+			}
+		}
+		assertHashEqual(t, "1536:74peLhFipssVfuInITTTZzMoW0379xy3u:VVFosEfudTj579k3u", d.String())
+	}
+}
+
+func TestDigestFromPipe(t *testing.T) {
+	blob := make([]byte, 200000)
+	rand.Read(blob)
+	expected, err := FuzzyBytes(blob)
+	assertNoError(t, err)
+
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < len(blob); i += 1000 {
+			pw.Write(blob[i : i+1000])
+		}
+		pw.Close()
+	}()
+	var w io.Writer = New()
+	_, err = io.Copy(w, pr)
+	assertNoError(t, err)
+	assertHashEqual(t, expected, w.(*Digest).String())
+}
+
+func TestDigestLowEntropyInputs(t *testing.T) {
+	// Inputs with few boundaries make FuzzyReader halve the block size several times.
+	b, err := ioutil.ReadFile("LICENSE")
+	assertNoError(t, err)
+	for _, blob := range [][]byte{
+		bytes.Repeat(b, 50),
+		bytes.Repeat([]byte{0x01, 0x94, 0xfd}, 2731),
+		append(make([]byte, 100000), b...),
+	} {
+		expected, expectedErr := FuzzyBytes(blob)
+		d := New()
+		d.Write(blob)
+		result, err := d.Sum()
+		if err != expectedErr {
+			t.Fatalf("Error mismatch: %v (expected) != %v (actual)", expectedErr, err)
+		}
+		assertHashEqual(t, expected, result)
+	}
+}
+
+func TestDigestSmallInputAndReset(t *testing.T) {
+	d := New()
+	d.Write(make([]byte, 100))
+	_, err := d.Sum()
+	if err != ErrSmallInput {
+		t.Fatalf("Expected ErrSmallInput, got %v", err)
+	}
+	assertHashEqual(t, "", d.String())
+
+	blob := make([]byte, 50000)
+	rand.Read(blob)
+	expected, err := FuzzyBytes(blob)
+	assertNoError(t, err)
+	d.Reset()
+	d.Write(blob[:20000])
+	d.Sum()
+	d.Write(blob[20000:])
+	if d.Size() != int64(len(blob)) {
+		t.Fatalf("Expected size %d, got %d", len(blob), d.Size())
+	}
+	assertHashEqual(t, expected, d.String())
+}
+
+func TestDigestMarshalBinary(t *testing.T) {
+	var _ encoding.BinaryMarshaler = (*Digest)(nil)
+	var _ encoding.BinaryUnmarshaler = (*Digest)(nil)
+
+	blob := make([]byte, 1000000)
+	rand.Read(blob)
+	expected, err := FuzzyBytes(blob)
+	assertNoError(t, err)
+
+	// Hash the data in chunks, moving the state to a new Digest after each of them
+	// as a worker resuming the job of another one would.
+	d := New()
+	for i := 0; i < len(blob); i += 100003 {
+		end := i + 100003
+		if end > len(blob) {
+			end = len(blob)
+		}
+		d.Write(blob[i:end])
+		data, err := d.MarshalBinary()
+		assertNoError(t, err)
+		d = new(Digest)
+		assertNoError(t, d.UnmarshalBinary(data))
+	}
+	assertHashEqual(t, expected, d.String())
+
+	data, err := d.MarshalBinary()
+	assertNoError(t, err)
+	for _, invalid := range [][]byte{nil, data[:len(data)-1], append(data, 0), []byte("ssd\x02")} {
+		if err := d.UnmarshalBinary(invalid); err != ErrInvalidState {
+			t.Errorf("Expected ErrInvalidState, got %v", err)
+		}
+	}
+	for i := range data {
+		if err := d.UnmarshalBinary(data[:i]); err != ErrInvalidState {
+			t.Errorf("Truncated to %d bytes: expected ErrInvalidState, got %v", i, err)
+		}
+	}
+	assertHashEqual(t, expected, d.String())
+}
+
+func TestIsBoundary(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		rh := r.Uint32()
+		n := r.Intn(maxBlockSizes)
+		if i%2 == 0 && n < 32 {
+			// Force the low bits, most random values are no boundary at all.
+			rh |= 1<<uint(n) - 1
+		}
+		blockSize := blockMin << uint(n)
+		expected := int64(rh)%blockSize == blockSize-1
+		if isBoundary(rh, n) != expected {
+			t.Fatalf("isBoundary(%d, %d) != %v", rh, n, expected)
+		}
+	}
+}
+
+func TestDigestWriteDoesNotAllocate(t *testing.T) {
+	blob := make([]byte, 100000)
+	rand.Read(blob)
+	d := New()
+	allocs := testing.AllocsPerRun(10, func() {
+		d.Write(blob)
+	})
+	if allocs != 0 {
+		t.Fatalf("Write allocated %v times", allocs)
+	}
+}
+
+func BenchmarkDigest(b *testing.B) {
+	blob := make([]byte, 4*1024*1024)
+	rand.Read(blob)
+	b.SetBytes(int64(len(blob)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d := New()
+		d.Write(blob)
+		d.Sum()
+	}
+}
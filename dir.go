@@ -0,0 +1,120 @@
+package ssdeep
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// DirOption configures FuzzyDir.
+type DirOption func(*dirOptions)
+
+type dirOptions struct {
+	concurrency int
+	skipSmall   bool
+	excludes    []string
+}
+
+// WithConcurrency makes FuzzyDir hash up to n files at once instead of one per CPU.
+func WithConcurrency(n int) DirOption {
+	return func(o *dirOptions) {
+		o.concurrency = n
+	}
+}
+
+// SkipSmallFiles makes FuzzyDir skip the files too small to be hashed instead of
+// reporting ErrSmallInput for each of them.
+func SkipSmallFiles() DirOption {
+	return func(o *dirOptions) {
+		o.skipSmall = true
+	}
+}
+
+// Exclude makes FuzzyDir skip the files and directories whose name matches one of the
+// patterns, using the syntax of filepath.Match. Excluded directories are not walked.
+func Exclude(patterns ...string) DirOption {
+	return func(o *dirOptions) {
+		o.excludes = append(o.excludes, patterns...)
+	}
+}
+
+// FuzzyDir walks the directory tree rooted at root and hashes its regular files with a
+// bounded pool of goroutines. Results are sent in completion order, and the channel is
+// closed once every file has been processed. Files or directories that could not be
+// read are reported as a Result with Err set.
+// Canceling ctx stops the walk and the workers: the results not sent yet are dropped and
+// the channel is closed, so that no goroutine is left behind even if the caller stops
+// receiving. A file being hashed is hashed completely first.
+// Returns an error when root is not a directory or an exclude pattern is malformed.
+func FuzzyDir(ctx context.Context, root string, opts ...DirOption) (<-chan Result, error) {
+	o := dirOptions{concurrency: runtime.NumCPU()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for _, pattern := range o.excludes {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New(root + " is not a directory")
+	}
+
+	paths := make(chan string)
+	results := make(chan Result)
+	walked := make(chan struct{})
+	go func() {
+		defer close(walked)
+		defer close(paths)
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				select {
+				case results <- Result{Path: path, Err: err}:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			if path != root && o.excluded(info.Name()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() || o.skipSmall && info.Size() < minFileSize {
+				return nil
+			}
+			select {
+			case paths <- path:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	go func() {
+		hashFiles(ctx, paths, results, o.concurrency)
+		// Once canceled, the workers may return before the walker is done.
+		<-walked
+		close(results)
+	}()
+	return results, nil
+}
+
+func (o dirOptions) excluded(name string) bool {
+	for _, pattern := range o.excludes {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
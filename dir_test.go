@@ -0,0 +1,89 @@
+package ssdeep
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestFuzzyDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssdeep")
+	assertNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	blob := make([]byte, 10000)
+	rand.Read(blob)
+	expected, err := FuzzyBytes(blob)
+	assertNoError(t, err)
+	for _, name := range []string{"a.bin", "sub/b.bin", "sub/c.log", "skip/d.bin"} {
+		path := filepath.Join(dir, name)
+		assertNoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assertNoError(t, ioutil.WriteFile(path, blob, 0600))
+	}
+	assertNoError(t, ioutil.WriteFile(filepath.Join(dir, "small"), blob[:100], 0600))
+
+	results, err := FuzzyDir(context.Background(), dir, WithConcurrency(2), Exclude("*.log", "skip"))
+	assertNoError(t, err)
+	byPath := make(map[string]Result)
+	for r := range results {
+		byPath[r.Path] = r
+	}
+	if len(byPath) != 3 {
+		t.Fatalf("Expected 3 results, got %+v", byPath)
+	}
+	for _, name := range []string{"a.bin", "sub/b.bin"} {
+		r := byPath[filepath.Join(dir, name)]
+		assertNoError(t, r.Err)
+		assertHashEqual(t, expected, r.Hash)
+	}
+	if err := byPath[filepath.Join(dir, "small")].Err; err != ErrSmallInput {
+		t.Errorf("Expected ErrSmallInput, got %v", err)
+	}
+
+	results, err = FuzzyDir(context.Background(), dir, SkipSmallFiles())
+	assertNoError(t, err)
+	n := 0
+	for range results {
+		n++
+	}
+	if n != 4 {
+		t.Errorf("Expected 4 results, got %d", n)
+	}
+
+	_, err = FuzzyDir(context.Background(), filepath.Join(dir, "a.bin"))
+	assertError(t, err)
+	_, err = FuzzyDir(context.Background(), dir, Exclude("["))
+	assertError(t, err)
+}
+
+func TestFuzzyDirCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssdeep")
+	assertNoError(t, err)
+	defer os.RemoveAll(dir)
+	blob := make([]byte, 5000)
+	for i := 0; i < 50; i++ {
+		assertNoError(t, ioutil.WriteFile(filepath.Join(dir, string(rune('a'+i%26))+string(rune('a'+i/26))), blob, 0600))
+	}
+
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := FuzzyDir(ctx, dir, WithConcurrency(4))
+	assertNoError(t, err)
+	<-results
+	cancel()
+	// Even if the caller stops receiving, every goroutine exits.
+	for i := 0; i < 500 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("Leaked goroutines: %d before, %d after", before, n)
+	}
+	if _, ok := <-results; ok {
+		t.Fatal("Results channel not closed after cancellation")
+	}
+}
@@ -5,38 +5,87 @@ package ssdeep
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// distance computes the weighted edit distance between two signatures, where
+// insertions and deletions cost 1 and substitutions cost 2.
+// Valid signatures only hold base64 characters, so they are compared byte-wise, and a
+// single row sized after the shorter string is kept instead of the full matrix. Other
+// strings are compared rune-wise.
 func distance(str1, str2 string) int {
-	var cost, lastdiag, olddiag int
-	s1 := []rune(str1)
-	s2 := []rune(str2)
-
-	lenS1 := len(s1)
-	lenS2 := len(s2)
+	if !isASCII(str1) || !isASCII(str2) {
+		return runeDistance([]rune(str1), []rune(str2))
+	}
+	if len(str1) > len(str2) {
+		str1, str2 = str2, str1
+	}
+	lenS1 := len(str1)
+	if lenS1 == 0 {
+		return len(str2)
+	}
 
-	column := make([]int, lenS1+1)
+	var buf [spamSumLength + 1]int
+	var column []int
+	if lenS1 < len(buf) {
+		column = buf[:lenS1+1]
+	} else {
+		column = make([]int, lenS1+1)
+	}
 
-	for y := 1; y <= lenS1; y++ {
+	for y := range column {
 		column[y] = y
 	}
 
-	for x := 1; x <= lenS2; x++ {
+	// Reslicing to a common length lets the compiler drop the bounds checks
+	// in the inner loop.
+	row := column[1:]
+	s1 := str1[:len(row)]
+	for x := 0; x < len(str2); x++ {
+		c := str2[x]
+		lastdiag := x
+		left := x + 1
+		for y, olddiag := range row {
+			cost := lastdiag
+			if s1[y] != c {
+				// Replace costs 2 in ssdeep
+				cost += 2
+			}
+			left = min(olddiag+1, left+1, cost)
+			row[y] = left
+			lastdiag = olddiag
+		}
+	}
+	return column[lenS1]
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// runeDistance is distance over runes, keeping the whole column.
+func runeDistance(s1, s2 []rune) int {
+	column := make([]int, len(s1)+1)
+	for y := range column {
+		column[y] = y
+	}
+	for x := 1; x <= len(s2); x++ {
 		column[0] = x
-		lastdiag = x - 1
-		for y := 1; y <= lenS1; y++ {
-			olddiag = column[y]
-			cost = 0
+		lastdiag := x - 1
+		for y := 1; y <= len(s1); y++ {
+			olddiag := column[y]
+			cost := 0
 			if s1[y-1] != s2[x-1] {
 				// Replace costs 2 in ssdeep
 				cost = 2
 			}
-			column[y] = min(
-				column[y]+1,
-				column[y-1]+1,
-				lastdiag+cost)
+			column[y] = min(column[y]+1, column[y-1]+1, lastdiag+cost)
 			lastdiag = olddiag
 		}
 	}
-	return column[lenS1]
+	return column[len(s1)]
 }
 
 func min(a, b, c int) int {
@@ -1,14 +1,13 @@
 package ssdeep_test
 
 import (
-	"github.com/glaslos/ssdeep"
-	"math/rand"
 	"fmt"
-	"os"
+	"github.com/chennqqi/ssdeep"
 	"log"
+	"math/rand"
+	"os"
 )
 
-
 func ExampleFuzzyFilename() {
 	f, err := os.Open("file.txt")
 	if err != nil {
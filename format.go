@@ -0,0 +1,253 @@
+package ssdeep
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FileHeader is the first line of ssdeep output files.
+const FileHeader = "ssdeep,1.1--blocksize:hash:hash,filename"
+
+// FormatWithFilename formats a hash and the name of the file it was computed from as a
+// line of ssdeep output, without the trailing newline: the filename is quoted by
+// QuoteFilename.
+func FormatWithFilename(hash, filename string) string {
+	return hash + "," + QuoteFilename(filename)
+}
+
+// QuoteFilename quotes filename as the ssdeep tool does: its quotes are escaped with a
+// backslash, and every other character, backslashes and newlines included, is written
+// as is.
+// As the ssdeep tool, a record is read as ending at the first line ending in a quote:
+// a filename holding a quote followed by a newline cannot be read back.
+func QuoteFilename(filename string) string {
+	return `"` + strings.Replace(filename, `"`, `\"`, -1) + `"`
+}
+
+// unquoteFilename returns the filename quoted by QuoteFilename. The last quote closes the
+// filename even when it follows a backslash, as the one of a filename ending with a
+// backslash does.
+// Returns ErrInvalidFilename when quoted is not a quoted filename.
+func unquoteFilename(quoted string) (string, error) {
+	if !quotedFilename(quoted) {
+		return "", ErrInvalidFilename
+	}
+	return strings.Replace(quoted[1:len(quoted)-1], `\"`, `"`, -1), nil
+}
+
+// quotedFilename reports whether s starts and ends with a quote.
+func quotedFilename(s string) bool {
+	return len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"'
+}
+
+// FileWriter writes hashes in the ssdeep output format, starting with FileHeader.
+// FileWriter is safe for concurrent use: lines are never interleaved.
+type FileWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	header bool
+}
+
+// NewFileWriter returns a FileWriter writing to w.
+func NewFileWriter(w io.Writer) *FileWriter {
+	return &FileWriter{w: w}
+}
+
+// Write writes p to the underlying writer as is, so that a FileWriter can be passed
+// wherever an io.Writer is expected.
+func (fw *FileWriter) Write(p []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.w.Write(p)
+}
+
+// WriteHash writes the line of hash and filename, preceded by the header on the first call.
+func (fw *FileWriter) WriteHash(hash, filename string) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if !fw.header {
+		if _, err := fmt.Fprintln(fw.w, FileHeader); err != nil {
+			return err
+		}
+		fw.header = true
+	}
+	_, err := fmt.Fprintln(fw.w, FormatWithFilename(hash, filename))
+	return err
+}
+
+// FuzzyFileTo computes the fuzzy hash of the file at path and writes it to w as a line of
+// ssdeep output. When w is a *FileWriter, the header precedes its first line, so results of
+// a batch can be streamed to a single output; any other writer only receives the line, and
+// writing the header is left to the caller.
+// Returns an error when the hash could not be computed or written.
+func FuzzyFileTo(w io.Writer, path string) error {
+	h, err := FuzzyFilename(path)
+	if err != nil {
+		return err
+	}
+	if fw, ok := w.(*FileWriter); ok {
+		return fw.WriteHash(h, path)
+	}
+	_, err = fmt.Fprintln(w, FormatWithFilename(h, path))
+	return err
+}
+
+// ReadHashFile reads an ssdeep output file as written by FileWriter, with a HashReader.
+// Returns an error when the file could not be read or holds an invalid record.
+func ReadHashFile(path string) ([]FuzzyHash, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewHashReader(f, path).ReadAll()
+}
+
+// ErrUnterminatedFilename is returned when the input ends within a quoted filename.
+var ErrUnterminatedFilename = errors.New("unterminated filename")
+
+// HashReader reads the records of an ssdeep output file, as written by FileWriter. The
+// header, blank lines and lines starting with # are skipped, and every hash is
+// validated like ParseFuzzyHash does. A record whose quoted filename holds a newline
+// continues on the next lines, up to the first one ending in a quote.
+type HashReader struct {
+	r    *bufio.Reader
+	name string
+	line int
+}
+
+// NewHashReader returns a HashReader reading from r. Errors hold name, when not empty,
+// and the line number of the invalid record.
+func NewHashReader(r io.Reader, name string) *HashReader {
+	return &HashReader{r: bufio.NewReader(r), name: name}
+}
+
+// Read returns the next hash, or io.EOF when there are no more hashes.
+// Returns an error when a record is invalid or r could not be read.
+func (hr *HashReader) Read() (*FuzzyHash, error) {
+	for {
+		record, err := hr.readLine()
+		if err != nil {
+			return nil, err
+		}
+		text := strings.TrimSpace(record)
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "ssdeep,") {
+			continue
+		}
+		start := hr.line
+		for {
+			i := strings.IndexByte(text, ',')
+			if i < 0 || !strings.HasPrefix(text[i+1:], `"`) || quotedFilename(text[i+1:]) {
+				break
+			}
+			next, err := hr.readLine()
+			if err == io.EOF {
+				return nil, hr.errorAt(start, ErrUnterminatedFilename)
+			}
+			if err != nil {
+				return nil, err
+			}
+			record += "\n" + next
+			text = strings.TrimSpace(record)
+		}
+		h, err := ParseFuzzyHash(text)
+		if err != nil {
+			return nil, hr.errorAt(start, err)
+		}
+		return h, nil
+	}
+}
+
+// ReadAll reads the remaining hashes.
+func (hr *HashReader) ReadAll() ([]FuzzyHash, error) {
+	var hashes []FuzzyHash
+	for {
+		h, err := hr.Read()
+		if err == io.EOF {
+			return hashes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, *h)
+	}
+}
+
+// readLine returns the next line without its newline, or io.EOF at the end of the input.
+// A carriage return is kept, as it may belong to a filename: it is trimmed along with the
+// spaces around a record.
+func (hr *HashReader) readLine() (string, error) {
+	line, err := hr.r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	hr.line++
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+func (hr *HashReader) errorAt(line int, err error) error {
+	if hr.name == "" {
+		return fmt.Errorf("line %d: %v", line, err)
+	}
+	return fmt.Errorf("%s:%d: %v", hr.name, line, err)
+}
+
+// FileMatch is a pair of similar hashes found in two ssdeep output files.
+type FileMatch struct {
+	FilenameA string
+	HashA     string
+	FilenameB string
+	HashB     string
+	Score     int
+}
+
+// CompareHashFiles reads two ssdeep output files and returns every pair of hashes, one
+// from each file, whose match score is at least threshold. Matches are ordered by their
+// position in the second file, best match first.
+// Returns an error when one of the files could not be read.
+func CompareHashFiles(pathA, pathB string, threshold int) ([]FileMatch, error) {
+	hashesA, err := ReadHashFile(pathA)
+	if err != nil {
+		return nil, err
+	}
+	hashesB, err := ReadHashFile(pathB)
+	if err != nil {
+		return nil, err
+	}
+
+	m := NewMatcher(nil)
+	for i := range hashesA {
+		if err := m.Add(strconv.Itoa(i), hashesA[i].Hash().String()); err != nil {
+			return nil, err
+		}
+	}
+	var matches []FileMatch
+	for j := range hashesB {
+		b := &hashesB[j]
+		found, err := m.Query(b.Hash().String(), threshold)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range found {
+			i, _ := strconv.Atoi(match.ID)
+			a := &hashesA[i]
+			matches = append(matches, FileMatch{
+				FilenameA: a.Filename(),
+				HashA:     a.Hash().String(),
+				FilenameB: b.Filename(),
+				HashB:     b.Hash().String(),
+				Score:     match.Score,
+			})
+		}
+	}
+	return matches, nil
+}
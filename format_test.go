@@ -0,0 +1,168 @@
+package ssdeep
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFormatWithFilename(t *testing.T) {
+	assertHashEqual(t, h1+`,"/tmp/a \"quoted\", name"`, FormatWithFilename(h1, `/tmp/a "quoted", name`))
+	// Only quotes are escaped.
+	for filename, expected := range map[string]string{
+		`C:\dir\a.exe`: `"C:\dir\a.exe"`,
+		`C:\dir\`:      `"C:\dir\"`,
+		`a\"b`:         `"a\\"b"`,
+		"a\nb":         "\"a\nb\"",
+	} {
+		line := FormatWithFilename(h1, filename)
+		assertHashEqual(t, h1+","+expected, line)
+		h, err := ParseFuzzyHash(line)
+		assertNoError(t, err)
+		assertHashEqual(t, filename, h.Filename())
+	}
+}
+
+func TestFuzzyFileTo(t *testing.T) {
+	expected := FileHeader + "\n" +
+		`1536:74peLhFipssVfuInITTTZzMoW0379xy3u:VVFosEfudTj579k3u,"ssdeep_results.json"` + "\n"
+
+	var buf bytes.Buffer
+	assertNoError(t, FuzzyFileTo(&buf, "ssdeep_results.json"))
+	assertNoError(t, FuzzyFileTo(&buf, "ssdeep_results.json"))
+	assertHashEqual(t, expected[len(FileHeader)+1:]+expected[len(FileHeader)+1:], buf.String())
+
+	buf.Reset()
+	fw := NewFileWriter(&buf)
+	assertNoError(t, FuzzyFileTo(fw, "ssdeep_results.json"))
+	assertNoError(t, FuzzyFileTo(fw, "ssdeep_results.json"))
+	assertHashEqual(t, expected+expected[len(FileHeader)+1:], buf.String())
+
+	assertError(t, FuzzyFileTo(fw, "foo.bar"))
+}
+
+func TestFileWriterConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	fw := NewFileWriter(&buf)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fw.WriteHash(h1, "file"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 11 || lines[0] != FileHeader {
+		t.Fatalf("Unexpected output:\n%s", buf.String())
+	}
+	for _, line := range lines[1:] {
+		assertHashEqual(t, FormatWithFilename(h1, "file"), line)
+	}
+}
+
+func TestReadHashFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssdeep")
+	assertNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hashes.txt")
+	var buf bytes.Buffer
+	fw := NewFileWriter(&buf)
+	assertNoError(t, fw.WriteHash(h1, `/tmp/a "quoted", name`))
+	buf.WriteString("\n# comment\n" + h3 + "\n")
+	assertNoError(t, ioutil.WriteFile(path, buf.Bytes(), 0600))
+
+	hashes, err := ReadHashFile(path)
+	assertNoError(t, err)
+	expected := []FuzzyHash{*newFuzzyHash(t, h1, `/tmp/a "quoted", name`), *newFuzzyHash(t, h3, "")}
+	if !reflect.DeepEqual(expected, hashes) {
+		t.Fatalf("%+v (expected) != %+v (actual)", expected, hashes)
+	}
+
+	// The records written by FileWriter may span several lines.
+	buf.Reset()
+	fw = NewFileWriter(&buf)
+	assertNoError(t, fw.WriteHash(h1, "multi\nline"))
+	assertNoError(t, fw.WriteHash(h3, `C:\dir\`))
+	assertNoError(t, ioutil.WriteFile(path, buf.Bytes(), 0600))
+	hashes, err = ReadHashFile(path)
+	assertNoError(t, err)
+	expected = []FuzzyHash{*newFuzzyHash(t, h1, "multi\nline"), *newFuzzyHash(t, h3, `C:\dir\`)}
+	if !reflect.DeepEqual(expected, hashes) {
+		t.Fatalf("%+v (expected) != %+v (actual)", expected, hashes)
+	}
+
+	assertNoError(t, ioutil.WriteFile(path, []byte(h1+",unquoted\n"), 0600))
+	_, err = ReadHashFile(path)
+	assertError(t, err)
+	assertNoError(t, ioutil.WriteFile(path, []byte(FileHeader+"\n"+h1+",\"a\nb\n"), 0600))
+	_, err = ReadHashFile(path)
+	assertHashEqual(t, path+":2: "+ErrUnterminatedFilename.Error(), err.Error())
+	_, err = ReadHashFile(filepath.Join(dir, "missing.txt"))
+	assertError(t, err)
+}
+
+func TestHashReaderSsdeepOutput(t *testing.T) {
+	// Records as the ssdeep tool writes them: the filename of the first one ends with a
+	// backslash, which is not escaped.
+	output := FileHeader + "\n" +
+		h1 + `,"a\"` + "\n" +
+		h2 + `,"b"` + "\n" +
+		h3 + `,"C:\dir\a \"x\".exe"` + "\n" +
+		h4 + ",\"multi\nline\\\"\n"
+	hashes, err := NewHashReader(strings.NewReader(output), "").ReadAll()
+	assertNoError(t, err)
+	expected := []FuzzyHash{
+		*newFuzzyHash(t, h1, `a\`),
+		*newFuzzyHash(t, h2, "b"),
+		*newFuzzyHash(t, h3, `C:\dir\a "x".exe`),
+		*newFuzzyHash(t, h4, "multi\nline\\"),
+	}
+	if !reflect.DeepEqual(expected, hashes) {
+		t.Fatalf("%+v (expected) != %+v (actual)", expected, hashes)
+	}
+}
+
+func TestCompareHashFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssdeep")
+	assertNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name string, hashes ...*FuzzyHash) string {
+		var buf bytes.Buffer
+		fw := NewFileWriter(&buf)
+		for _, fh := range hashes {
+			assertNoError(t, fw.WriteHash(fh.Hash().String(), fh.Filename()))
+		}
+		path := filepath.Join(dir, name)
+		assertNoError(t, ioutil.WriteFile(path, buf.Bytes(), 0600))
+		return path
+	}
+	pathA := write("a.txt", newFuzzyHash(t, h1, "a1"), newFuzzyHash(t, h3, "a3"))
+	pathB := write("b.txt", newFuzzyHash(t, h4, "b4"), newFuzzyHash(t, h2, "b2"))
+
+	matches, err := CompareHashFiles(pathA, pathB, 30)
+	assertNoError(t, err)
+	expected := []FileMatch{
+		{FilenameA: "a3", HashA: h3, FilenameB: "b4", HashB: h4, Score: 97},
+		{FilenameA: "a1", HashA: h1, FilenameB: "b2", HashB: h2, Score: 35},
+	}
+	if !reflect.DeepEqual(expected, matches) {
+		t.Fatalf("%+v (expected) != %+v (actual)", expected, matches)
+	}
+
+	matches, err = CompareHashFiles(pathA, pathB, 50)
+	assertNoError(t, err)
+	if len(matches) != 1 {
+		t.Fatalf("Expected a single match, got %+v", matches)
+	}
+}
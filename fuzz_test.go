@@ -0,0 +1,25 @@
+//go:build go1.18
+// +build go1.18
+
+package ssdeep
+
+import "testing"
+
+func FuzzCompareUntrusted(f *testing.F) {
+	f.Add(h1, h2)
+	f.Add(h3, h4)
+	f.Add("3::", "6::")
+	f.Add("3:abc:def", "6:abcdefgh:")
+	f.Fuzz(func(t *testing.T, hash1, hash2 string) {
+		score, err := CompareUntrusted(hash1, hash2)
+		if err != nil {
+			if score != 0 {
+				t.Fatalf("Score %d returned along with error %v", score, err)
+			}
+			return
+		}
+		if score < 0 || score > 100 {
+			t.Fatalf("Score %d out of range", score)
+		}
+	})
+}
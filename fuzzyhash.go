@@ -0,0 +1,88 @@
+package ssdeep
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidFilename is returned when the filename following a signature is not quoted.
+var ErrInvalidFilename = errors.New("invalid filename")
+
+// FuzzyHash is a validated signature, along with the name of the file it was computed
+// from when known, as found in ssdeep output.
+type FuzzyHash struct {
+	hash     Hash
+	filename string
+}
+
+// ParseFuzzyHash parses a signature of the form blocksize:hash1:hash2, optionally
+// followed by ,"filename" as written by FormatWithFilename. The signature is validated
+// like ParseUntrusted does.
+// Returns an error when the signature is invalid or the filename is not properly quoted.
+func ParseFuzzyHash(s string) (*FuzzyHash, error) {
+	s = strings.TrimSpace(s)
+	var filename string
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		var err error
+		if filename, err = unquoteFilename(s[i+1:]); err != nil {
+			return nil, err
+		}
+		s = s[:i]
+	}
+	return NewFuzzyHash(s, filename)
+}
+
+// NewFuzzyHash returns the FuzzyHash of hash, a signature of the form
+// blocksize:hash1:hash2, computed from the file filename, which may be empty.
+// Returns an error when the signature is invalid.
+func NewFuzzyHash(hash, filename string) (*FuzzyHash, error) {
+	h, err := ParseUntrusted(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &FuzzyHash{hash: h, filename: filename}, nil
+}
+
+// BlockSize returns the block size the first signature was computed at.
+func (h *FuzzyHash) BlockSize() int64 {
+	return h.hash.BlockSize
+}
+
+// Digest1 returns the signature computed at the block size.
+func (h *FuzzyHash) Digest1() string {
+	return h.hash.Hash1
+}
+
+// Digest2 returns the signature computed at twice the block size.
+func (h *FuzzyHash) Digest2() string {
+	return h.hash.Hash2
+}
+
+// Filename returns the name of the file the hash was computed from, or an empty string
+// when it was not given.
+func (h *FuzzyHash) Filename() string {
+	return h.filename
+}
+
+// Hash returns the signature without its filename, for use with HashDistance.
+func (h *FuzzyHash) Hash() Hash {
+	return h.hash
+}
+
+// Validate checks the block size, the alphabet and the length of both signatures.
+// A FuzzyHash returned by ParseFuzzyHash is always valid.
+func (h *FuzzyHash) Validate() error {
+	if !validBlockSize(h.hash.BlockSize) {
+		return ErrInvalidBlockSize
+	}
+	return h.hash.validate()
+}
+
+// String returns the signature in its blocksize:hash1:hash2 form, followed by the
+// quoted filename when known, as parsed by ParseFuzzyHash.
+func (h *FuzzyHash) String() string {
+	if h.filename == "" {
+		return h.hash.String()
+	}
+	return FormatWithFilename(h.hash.String(), h.filename)
+}
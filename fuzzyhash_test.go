@@ -0,0 +1,59 @@
+package ssdeep
+
+import "testing"
+
+func TestParseFuzzyHash(t *testing.T) {
+	h, err := ParseFuzzyHash(h1)
+	assertNoError(t, err)
+	if h.BlockSize() != 192 {
+		t.Errorf("Block size mismatch: 192 (expected) != %d (actual)", h.BlockSize())
+	}
+	assertHashEqual(t, "MUPMinqP6+wNQ7Q40L/iB3n2rIBrP0GZKF4jsef+0FVQLSwbLbj41iH8nFVYv980", h.Digest1())
+	assertHashEqual(t, "x0CllivQiFmt", h.Digest2())
+	assertHashEqual(t, "", h.Filename())
+	assertHashEqual(t, h1, h.String())
+	assertNoError(t, h.Validate())
+
+	line := h3 + `,"/tmp/a, \"b\".exe"`
+	h, err = ParseFuzzyHash(line + "\n")
+	assertNoError(t, err)
+	assertHashEqual(t, `/tmp/a, "b".exe`, h.Filename())
+	assertHashEqual(t, line, h.String())
+	if h.Hash() != (Hash{BlockSize: 196608, Hash1: h.Digest1(), Hash2: h.Digest2()}) {
+		t.Errorf("Hash mismatch: %+v", h.Hash())
+	}
+
+	for s, expected := range map[string]error{
+		"5:abc:def":     ErrInvalidBlockSize,
+		"6:abc-def:ghi": ErrInvalidCharacter,
+		"6:abc":         ErrInvalidFormat,
+	} {
+		if _, err := ParseFuzzyHash(s); err != expected {
+			t.Errorf("%q: expected %v, got %v", s, expected, err)
+		}
+	}
+	for _, s := range []string{h1 + `,filename`, h1 + `,"filename`} {
+		_, err := ParseFuzzyHash(s)
+		assertError(t, err)
+	}
+
+	if err := (&FuzzyHash{}).Validate(); err != ErrInvalidBlockSize {
+		t.Errorf("Expected ErrInvalidBlockSize for the zero FuzzyHash, got %v", err)
+	}
+}
+
+func TestNewFuzzyHash(t *testing.T) {
+	h, err := NewFuzzyHash(h3, "a\nb.exe")
+	assertNoError(t, err)
+	assertHashEqual(t, h3, h.Hash().String())
+	assertHashEqual(t, "a\nb.exe", h.Filename())
+
+	_, err = NewFuzzyHash(h3+`,"a.exe"`, "")
+	assertError(t, err)
+}
+
+func newFuzzyHash(t *testing.T, hash, filename string) *FuzzyHash {
+	h, err := NewFuzzyHash(hash, filename)
+	assertNoError(t, err)
+	return h
+}
@@ -0,0 +1,280 @@
+package ssdeep
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidFormat is returned when a signature is not of the form blocksize:hash1:hash2.
+var ErrInvalidFormat = errors.New("invalid ssdeep format")
+
+// ErrInvalidBlockSize is returned when a signature's block size is not a blockMin * 2^n value.
+var ErrInvalidBlockSize = errors.New("invalid block size")
+
+// ErrInvalidCharacter is returned when a signature contains a character outside of the base64 alphabet.
+var ErrInvalidCharacter = errors.New("invalid character in signature")
+
+// ErrSignatureTooLong is returned when a signature is longer than ssdeep can produce.
+var ErrSignatureTooLong = errors.New("signature too long")
+
+// maxHashLength bounds the length of a signature string: a block size of at most 19
+// digits, two separators and the two signatures.
+const maxHashLength = 19 + 2 + spamSumLength + spamSumLength/2
+
+// Hash is a fuzzy hash signature split into its block size and its two hash strings.
+type Hash struct {
+	BlockSize int64
+	Hash1     string
+	Hash2     string
+}
+
+// ParseHash parses a signature of the form blocksize:hash1:hash2 as returned by FuzzyReader.
+// Returns an error when the signature is malformed or its block size could not
+// have been produced by ssdeep.
+func ParseHash(s string) (Hash, error) {
+	// Split by hand rather than with strings.Split: ParseHash sits on the
+	// comparison hot path and this avoids allocating the parts slice.
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return Hash{}, ErrInvalidFormat
+	}
+	j := strings.IndexByte(s[i+1:], ':')
+	if j < 0 {
+		return Hash{}, ErrInvalidFormat
+	}
+	j += i + 1
+	if strings.IndexByte(s[j+1:], ':') >= 0 {
+		return Hash{}, ErrInvalidFormat
+	}
+	blockSize, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil {
+		return Hash{}, ErrInvalidFormat
+	}
+	if !validBlockSize(blockSize) {
+		return Hash{}, ErrInvalidBlockSize
+	}
+	return Hash{BlockSize: blockSize, Hash1: s[i+1 : j], Hash2: s[j+1:]}, nil
+}
+
+// String returns the signature in its blocksize:hash1:hash2 form.
+func (h Hash) String() string {
+	return strconv.FormatInt(h.BlockSize, 10) + ":" + h.Hash1 + ":" + h.Hash2
+}
+
+// validBlockSize reports whether blockSize is blockMin multiplied by a power of two.
+func validBlockSize(blockSize int64) bool {
+	if blockSize < blockMin || blockSize%blockMin != 0 {
+		return false
+	}
+	n := blockSize / blockMin
+	return n&(n-1) == 0
+}
+
+// Signatures returns the two hash strings of the signature without its block size.
+func (h Hash) Signatures() (string, string) {
+	return h.Hash1, h.Hash2
+}
+
+// HashFromSignatures builds a Hash from a block size and two hash strings stored
+// separately, as returned by Signatures.
+// Returns an error when the block size could not have been produced by ssdeep
+// or when one of the hash strings contains a colon.
+func HashFromSignatures(blockSize int64, hash1, hash2 string) (Hash, error) {
+	if !validBlockSize(blockSize) {
+		return Hash{}, ErrInvalidBlockSize
+	}
+	if strings.Contains(hash1, ":") || strings.Contains(hash2, ":") {
+		return Hash{}, ErrInvalidFormat
+	}
+	return Hash{BlockSize: blockSize, Hash1: hash1, Hash2: hash2}, nil
+}
+
+// Canonicalize returns the canonical form of a signature, so that signatures differing
+// only cosmetically compare equal as strings. It strips a trailing comment starting
+// with '#', a trailing ,"filename" as found in ssdeep output, surrounding whitespace
+// and leading zeros of the block size.
+// Returns an error when what remains is not a valid signature.
+func Canonicalize(s string) (string, error) {
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		s = s[:i]
+	}
+	h, err := ParseHash(strings.TrimSpace(s))
+	if err != nil {
+		return "", err
+	}
+	return h.String(), nil
+}
+
+// DedupOption configures Dedup.
+type DedupOption func(*dedupOptions)
+
+type dedupOptions struct {
+	skipInvalid bool
+}
+
+// SkipInvalid makes Dedup drop invalid signatures instead of failing.
+func SkipInvalid() DedupOption {
+	return func(o *dedupOptions) {
+		o.skipInvalid = true
+	}
+}
+
+// Dedup canonicalizes hashes and returns the unique signatures in the order they were
+// first seen. Blank and comment-only entries are ignored.
+// Returns an error on the first invalid signature, unless SkipInvalid is given.
+func Dedup(hashes []string, opts ...DedupOption) ([]string, error) {
+	var o dedupOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	seen := make(map[string]struct{}, len(hashes))
+	unique := make([]string, 0, len(hashes))
+	for _, s := range hashes {
+		if i := strings.IndexByte(s, '#'); i >= 0 {
+			s = s[:i]
+		}
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		c, err := Canonicalize(s)
+		if err != nil {
+			if o.skipInvalid {
+				continue
+			}
+			return nil, err
+		}
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+		unique = append(unique, c)
+	}
+	return unique, nil
+}
+
+// validate checks that both signatures only use the base64 alphabet and are not longer
+// than the signatures ssdeep produces.
+func (h Hash) validate() error {
+	if len(h.Hash1) > spamSumLength || len(h.Hash2) > spamSumLength/2 {
+		return ErrSignatureTooLong
+	}
+	for _, signature := range []string{h.Hash1, h.Hash2} {
+		for i := 0; i < len(signature); i++ {
+			if strings.IndexByte(b64String, signature[i]) < 0 {
+				return ErrInvalidCharacter
+			}
+		}
+	}
+	return nil
+}
+
+// ParseUntrusted parses a signature of the form blocksize:hash1:hash2 and validates
+// every field, which suits signatures from untrusted sources such as user input or a
+// database: on top of the checks of ParseHash, the hash strings must only use the base64
+// alphabet and be no longer than the ones ssdeep produces, and the work done on
+// oversized input is bounded.
+// Returns ErrInvalidFormat, ErrInvalidBlockSize, ErrInvalidCharacter or
+// ErrSignatureTooLong depending on what is wrong with the signature.
+func ParseUntrusted(s string) (Hash, error) {
+	if len(s) > maxHashLength {
+		return Hash{}, ErrSignatureTooLong
+	}
+	h, err := ParseHash(s)
+	if err != nil {
+		return Hash{}, err
+	}
+	if err := h.validate(); err != nil {
+		return Hash{}, err
+	}
+	return h, nil
+}
+
+// ParsedHash is a signature split into its fields, as returned by Parse.
+type ParsedHash Hash
+
+// Parse parses a signature of the form blocksize:hash1:hash2 and validates every field
+// like ParseUntrusted does.
+// Returns ErrInvalidFormat, ErrInvalidBlockSize, ErrInvalidCharacter or
+// ErrSignatureTooLong depending on what is wrong with the signature.
+func Parse(s string) (ParsedHash, error) {
+	h, err := ParseUntrusted(s)
+	return ParsedHash(h), err
+}
+
+// String returns the signature in the canonical form blocksize:hash1:hash2, which Parse
+// reads back.
+func (h ParsedHash) String() string {
+	return Hash(h).String()
+}
+
+// EliminateSequences returns h with every run of more than three identical characters
+// in its signatures collapsed to three, as ssdeep does before comparing signatures.
+// Comparing normalized hashes gives the same scores as comparing the original ones.
+func (h Hash) EliminateSequences() Hash {
+	h.Hash1 = eliminateSequences(h.Hash1)
+	h.Hash2 = eliminateSequences(h.Hash2)
+	return h
+}
+
+func eliminateSequences(s string) string {
+	i := 3
+	for ; i < len(s); i++ {
+		if s[i] == s[i-1] && s[i] == s[i-2] && s[i] == s[i-3] {
+			break
+		}
+	}
+	if i >= len(s) {
+		// Most signatures have no long run, spare them an allocation.
+		return s
+	}
+	b := []byte(s[:i])
+	for ; i < len(s); i++ {
+		if s[i] != s[i-1] || s[i] != s[i-2] || s[i] != s[i-3] {
+			b = append(b, s[i])
+		}
+	}
+	return string(b)
+}
+
+// AlgorithmVersion identifies the hashing algorithm implemented by this package.
+// It changes whenever the same input would hash differently, so that systems storing
+// hashes over a long time can tell which ones need to be recomputed.
+//
+// Version 2 ends full signatures like libfuzzy when the rolling hash is zero at the end
+// of the input, typically for inputs ending with zero padding: version 1 hashes of such
+// inputs lack the last character of their full signatures.
+const AlgorithmVersion = 2
+
+// SameAlgorithm reports whether both signatures look like they were produced by this
+// package's algorithm: a block size following the blockMin * 2^n progression, signatures
+// using the base64 alphabet, and signature lengths within the limits of the algorithm.
+// It is a heuristic: it flags obviously foreign hashes before they are compared, but it
+// cannot prove where a hash comes from.
+func SameAlgorithm(hash1, hash2 string) bool {
+	if _, err := ParseUntrusted(hash1); err != nil {
+		return false
+	}
+	_, err := ParseUntrusted(hash2)
+	return err == nil
+}
+
+// CompatibleBlockSizes returns the block sizes of the hashes h can be compared to, in
+// increasing order: half its block size, unless below blockMin, its own block size and
+// twice its block size.
+func (h Hash) CompatibleBlockSizes() []int64 {
+	sizes := make([]int64, 0, 3)
+	if h.BlockSize/2 >= blockMin {
+		sizes = append(sizes, h.BlockSize/2)
+	}
+	sizes = append(sizes, h.BlockSize)
+	if h.BlockSize <= math.MaxInt64/2 {
+		sizes = append(sizes, h.BlockSize*2)
+	}
+	return sizes
+}
@@ -0,0 +1,184 @@
+package ssdeep
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHash(t *testing.T) {
+	h, err := ParseHash(h1)
+	assertNoError(t, err)
+	if h.BlockSize != 192 {
+		t.Errorf("Block size mismatch: 192 (expected) != %d (actual)", h.BlockSize)
+	}
+	assertHashEqual(t, "MUPMinqP6+wNQ7Q40L/iB3n2rIBrP0GZKF4jsef+0FVQLSwbLbj41iH8nFVYv980", h.Hash1)
+	assertHashEqual(t, "x0CllivQiFmt", h.Hash2)
+	assertHashEqual(t, h1, h.String())
+}
+
+func TestParseHashInvalidFormat(t *testing.T) {
+	for _, s := range []string{"", "192:asdasd", "a:b:c", "192:a:b:c"} {
+		if _, err := ParseHash(s); err != ErrInvalidFormat {
+			t.Errorf("%q: expected ErrInvalidFormat, got %v", s, err)
+		}
+	}
+}
+
+func TestParseHashInvalidBlockSize(t *testing.T) {
+	for _, s := range []string{"0:a:b", "-3:a:b", "1:a:b", "5:a:b", "9:a:b", "96000:a:b"} {
+		if _, err := ParseHash(s); err != ErrInvalidBlockSize {
+			t.Errorf("%q: expected ErrInvalidBlockSize, got %v", s, err)
+		}
+	}
+	for _, s := range []string{"3:a:b", "6:a:b", "196608:a:b"} {
+		_, err := ParseHash(s)
+		assertNoError(t, err)
+	}
+}
+
+func TestParseUntrusted(t *testing.T) {
+	for _, s := range []string{h1, h2, "3::", "6:abc+/09:xyz"} {
+		h, err := ParseUntrusted(s)
+		assertNoError(t, err)
+		assertHashEqual(t, s, h.String())
+	}
+	for s, expected := range map[string]error{
+		"192:abc":                             ErrInvalidFormat,
+		"192:a:b:c":                           ErrInvalidFormat,
+		"x:abc:def":                           ErrInvalidFormat,
+		"5:abc:def":                           ErrInvalidBlockSize,
+		"-6:abc:def":                          ErrInvalidBlockSize,
+		"6:abc-def:ghi":                       ErrInvalidCharacter,
+		"6:abc:de f":                          ErrInvalidCharacter,
+		"6:" + strings.Repeat("a", 65) + ":b": ErrSignatureTooLong,
+		"6:a:" + strings.Repeat("b", 33):      ErrSignatureTooLong,
+		strings.Repeat("1", maxHashLength+1):  ErrSignatureTooLong,
+	} {
+		if _, err := ParseUntrusted(s); err != expected {
+			t.Errorf("%.40q: expected %v, got %v", s, expected, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{h1, h2, "3::", "6:abc+/09:xyz"} {
+		h, err := Parse(s)
+		assertNoError(t, err)
+		assertHashEqual(t, s, h.String())
+		expected, _ := ParseUntrusted(s)
+		if Hash(h) != expected {
+			t.Errorf("%q: %+v (expected) != %+v (actual)", s, expected, h)
+		}
+	}
+	for _, s := range []string{"192:abc", "5:abc:def", "6:abc-def:ghi", "6:a:" + strings.Repeat("b", 33)} {
+		_, expected := ParseUntrusted(s)
+		if _, err := Parse(s); err != expected {
+			t.Errorf("%.40q: expected %v, got %v", s, expected, err)
+		}
+	}
+}
+
+func TestHashSignaturesRoundTrip(t *testing.T) {
+	h, err := ParseHash(h3)
+	assertNoError(t, err)
+	s1, s2 := h.Signatures()
+	assertHashEqual(t, "pDSC8olnoL1v/uawvbQD7XlZUFYzYyMb615NktYHF7dREN/JNnQrmhnUPI+/n2Yr", s1)
+	assertHashEqual(t, "5DHoJXv7XOq7Mb2TwYHXREN/3QrmktPd", s2)
+
+	rebuilt, err := HashFromSignatures(h.BlockSize, s1, s2)
+	assertNoError(t, err)
+	assertHashEqual(t, h3, rebuilt.String())
+
+	_, err = HashFromSignatures(5, s1, s2)
+	assertError(t, err)
+	_, err = HashFromSignatures(3, "a:b", s2)
+	assertError(t, err)
+}
+
+func TestCanonicalize(t *testing.T) {
+	for _, s := range []string{
+		h1,
+		"  " + h1 + "\n",
+		h1 + " # known sample",
+		h1 + `,"/tmp/file, with comma"`,
+		"0" + h1,
+	} {
+		c, err := Canonicalize(s)
+		assertNoError(t, err)
+		assertHashEqual(t, h1, c)
+	}
+	_, err := Canonicalize("# only a comment")
+	assertError(t, err)
+}
+
+func TestDedup(t *testing.T) {
+	hashes := []string{h3, " " + h1, "", "# comment", h3 + " # again", h1 + `,"file"`, h2}
+	unique, err := Dedup(hashes)
+	assertNoError(t, err)
+	expected := []string{h3, h1, h2}
+	if len(unique) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, unique)
+	}
+	for i := range expected {
+		assertHashEqual(t, expected[i], unique[i])
+	}
+
+	_, err = Dedup([]string{h1, "not a hash"})
+	assertError(t, err)
+
+	unique, err = Dedup([]string{h1, "not a hash", h1}, SkipInvalid())
+	assertNoError(t, err)
+	if len(unique) != 1 {
+		t.Fatalf("Expected a single hash, got %v", unique)
+	}
+}
+
+func TestEliminateSequences(t *testing.T) {
+	for s, expected := range map[string]string{
+		"":             "",
+		"abc":          "abc",
+		"aaab":         "aaab",
+		"aaaab":        "aaab",
+		"baaaaaaaaacd": "baaacd",
+		"aaaabbbbcccc": "aaabbbccc",
+	} {
+		assertHashEqual(t, expected, eliminateSequences(s))
+	}
+}
+
+func TestSameAlgorithm(t *testing.T) {
+	if !SameAlgorithm(h1, h3) {
+		t.Error("Hashes from ssdeep should be recognized")
+	}
+	for _, foreign := range []string{
+		"5:abc:def",
+		"3:abc-def:ghi",
+		"3:a:" + strings.Repeat("b", spamSumLength),
+		"T1A2B3C4D5E6F7",
+	} {
+		if SameAlgorithm(h1, foreign) || SameAlgorithm(foreign, h1) {
+			t.Errorf("%.40q should be flagged as foreign", foreign)
+		}
+	}
+}
+
+func TestCompatibleBlockSizes(t *testing.T) {
+	for blockSize, expected := range map[int64][]int64{
+		3:   {3, 6},
+		6:   {3, 6, 12},
+		192: {96, 192, 384},
+	} {
+		sizes := Hash{BlockSize: blockSize}.CompatibleBlockSizes()
+		if !reflect.DeepEqual(expected, sizes) {
+			t.Errorf("Block size %d: %v (expected) != %v (actual)", blockSize, expected, sizes)
+		}
+		for _, s := range sizes {
+			reason, err := Incompatibility(Hash{BlockSize: blockSize}.String(), Hash{BlockSize: s}.String())
+			assertNoError(t, err)
+			if strings.HasPrefix(reason, "block sizes") {
+				t.Errorf("Block sizes %d and %d should be compatible", blockSize, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Package hashlist reads and writes hash lists, the output format of the ssdeep tool, also
+// read back by ssdeep -m and found in hash dumps of other tools:
+//
+//	ssdeep,1.1--blocksize:hash:hash,filename
+//	192:JkjRcePWsNVQza3ntZStn5VfsoXMhRD9+xJMinqF6+wNQ7Q40L/i737rPVt:JkjlQyIrx+kll2,"/tmp/a, \"b\""
+//
+// The first line is a header, and every other line holds a hash followed by the name of the
+// file it was computed from, quoted as ssdeep.QuoteFilename does: its quotes are escaped
+// with a backslash, and it is written as is otherwise, so that a filename holding a newline
+// spans several lines. A record ends at the first line ending in a quote.
+//
+// The format is the one of ssdeep.FileWriter and ssdeep.ReadHashFile, which this package
+// wraps to work on ssdeep.FuzzyHash values.
+package hashlist
+
+import (
+	"io"
+
+	"github.com/chennqqi/ssdeep"
+)
+
+// Reader reads the hashes of a hash list. The header, blank lines and lines starting with
+// # are skipped. Hashes without a filename are accepted, as ssdeep.ReadHashFile does.
+type Reader struct {
+	hr *ssdeep.HashReader
+}
+
+// NewReader returns a Reader reading the hash list from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{hr: ssdeep.NewHashReader(r, "")}
+}
+
+// Read returns the next hash of the list, or io.EOF when there are no more hashes.
+// Returns an error holding the line number when a hash is invalid, or
+// ssdeep.ErrUnterminatedFilename when the list ends within a filename.
+func (r *Reader) Read() (*ssdeep.FuzzyHash, error) {
+	return r.hr.Read()
+}
+
+// ReadAll reads the remaining hashes of the list.
+func (r *Reader) ReadAll() ([]ssdeep.FuzzyHash, error) {
+	return r.hr.ReadAll()
+}
+
+// Writer writes hashes as a hash list, the header preceding the first hash.
+// Writer is safe for concurrent use: records are never interleaved.
+type Writer struct {
+	fw *ssdeep.FileWriter
+}
+
+// NewWriter returns a Writer writing the hash list to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{fw: ssdeep.NewFileWriter(w)}
+}
+
+// Write writes the record of h. A hash without a filename is written with an empty one,
+// as ssdeep -m expects every hash to have one.
+func (w *Writer) Write(h *ssdeep.FuzzyHash) error {
+	return w.fw.WriteHash(h.Hash().String(), h.Filename())
+}
+
+// WriteAll writes the records of hashes.
+func (w *Writer) WriteAll(hashes []ssdeep.FuzzyHash) error {
+	for i := range hashes {
+		if err := w.Write(&hashes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
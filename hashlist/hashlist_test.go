@@ -0,0 +1,110 @@
+package hashlist
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/chennqqi/ssdeep"
+)
+
+const (
+	h1 = "192:MUPMinqP6+wNQ7Q40L/iB3n2rIBrP0GZKF4jsef+0FVQLSwbLbj41iH8nFVYv980:x0CllivQiFmt"
+	h2 = "192:JkjRcePWsNVQza3ntZStn5VfsoXMhRD9+xJMinqF6+wNQ7Q40L/i737rPVt:JkjlQyIrx+kll2"
+	h3 = "3:AXGBicFlgVNhBGcL6wCrFQEv:AXGHsNhxLsr2C"
+)
+
+func TestReadAll(t *testing.T) {
+	list := ssdeep.FileHeader + "\r\n" +
+		"# exported from the C tool\r\n" +
+		"\r\n" +
+		h1 + `,"/tmp/a, \"b\".exe"` + "\r\n" +
+		h2 + `,"/tmp/multi` + "\n" + `line, name"` + "\n" +
+		"  " + h3 + "  \n" +
+		h3 + `,""`
+	hashes, err := NewReader(strings.NewReader(list)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct{ hash, filename string }{
+		{h1, `/tmp/a, "b".exe`},
+		{h2, "/tmp/multi\nline, name"},
+		{h3, ""},
+		{h3, ""},
+	}
+	if len(hashes) != len(expected) {
+		t.Fatalf("Expected %d hashes, got %d", len(expected), len(hashes))
+	}
+	for i, e := range expected {
+		if hashes[i].Hash().String() != e.hash || hashes[i].Filename() != e.filename {
+			t.Errorf("Hash %d: %q,%q (expected) != %q,%q (actual)", i, e.hash, e.filename, hashes[i].Hash(), hashes[i].Filename())
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for list, expected := range map[string]string{
+		ssdeep.FileHeader + "\n" + h1 + ",\"a\n\nb\n":     "line 2: " + ssdeep.ErrUnterminatedFilename.Error(),
+		ssdeep.FileHeader + "\n" + h1 + ",\"a\\\"\nb\"\n": "line 3: " + ssdeep.ErrInvalidFormat.Error(),
+		"# comment\n" + h1 + "\n5:abc:def,\"a\"\n":        "line 3: " + ssdeep.ErrInvalidBlockSize.Error(),
+		h1 + ",a\n": "line 1: invalid filename",
+		ssdeep.FileHeader + "\n" + h1 + ",\"a\nb\"\nfoo\n": "line 4: " + ssdeep.ErrInvalidFormat.Error(),
+	} {
+		_, err := NewReader(strings.NewReader(list)).ReadAll()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected %q, got %v", list, expected, err)
+		}
+	}
+
+	r := NewReader(strings.NewReader(ssdeep.FileHeader + "\n"))
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestWriteAllRoundTrip(t *testing.T) {
+	var hashes []ssdeep.FuzzyHash
+	for _, e := range []struct{ hash, filename string }{
+		{h1, `C:\samples\a, "b".exe`},
+		{h2, "multi\nline\r\nname"},
+		{h3, ""},
+		{h1, `C:\dir\`},
+		{h2, "b"},
+		{h3, `a\"b\\"c\\`},
+	} {
+		h, err := ssdeep.NewFuzzyHash(e.hash, e.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, *h)
+	}
+
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).WriteAll(hashes); err != nil {
+		t.Fatal(err)
+	}
+	expected := ssdeep.FileHeader + "\n" +
+		h1 + `,"C:\samples\a, \"b\".exe"` + "\n" +
+		h2 + ",\"multi\nline\r\nname\"\n" +
+		h3 + `,""` + "\n" +
+		h1 + `,"C:\dir\"` + "\n" +
+		h2 + `,"b"` + "\n" +
+		h3 + `,"a\\"b\\\"c\\"` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("Unexpected output:\n%s", buf.String())
+	}
+
+	read, err := NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(hashes) {
+		t.Fatalf("Expected %d hashes, got %d", len(hashes), len(read))
+	}
+	for i := range hashes {
+		if read[i].String() != hashes[i].String() {
+			t.Errorf("Hash %d: %q (expected) != %q (actual)", i, hashes[i].String(), read[i].String())
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package ssdeep
+
+import (
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Index holds known hashes along with a label for each, such as the name of the file
+// they were computed from, and finds the ones similar to a query hash like ssdeep -m
+// does with a file of known hashes. Lookups go through a Matcher, so a query is only
+// compared to the hashes sharing a block size and a 7-character substring with it rather
+// than to every known hash.
+// Index is safe for concurrent use.
+type Index struct {
+	matcher *Matcher
+
+	mu      sync.RWMutex
+	entries []FuzzyHash
+}
+
+// NewIndex returns an empty Index.
+func NewIndex() *Index {
+	return &Index{matcher: NewMatcher(nil)}
+}
+
+// Add adds hash to the index under label. Several hashes can share a label.
+// Returns an error when hash is not a valid signature.
+func (idx *Index) Add(hash, label string) error {
+	h, err := NewFuzzyHash(hash, label)
+	if err != nil {
+		return err
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.matcher.Add(strconv.Itoa(len(idx.entries)), hash); err != nil {
+		return err
+	}
+	idx.entries = append(idx.entries, *h)
+	return nil
+}
+
+// Len returns the number of hashes in the index.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.entries)
+}
+
+// Match returns the labels of the hashes whose match score with hash is at least
+// threshold, best match first, as the ID of each Match. A zero score is never a match.
+// Returns an error when hash is not a valid signature.
+func (idx *Index) Match(hash string, threshold int) ([]Match, error) {
+	found, err := idx.matcher.Query(hash, threshold)
+	if err != nil {
+		return nil, err
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	matches := make([]Match, len(found))
+	for i, m := range found {
+		n, _ := strconv.Atoi(m.ID)
+		matches[i] = Match{ID: idx.entries[n].Filename(), Score: m.Score}
+	}
+	sortMatches(matches)
+	return matches, nil
+}
+
+// Save writes the hashes of the index to w in the ssdeep output format, each label in
+// place of the filename, so that the file can also be used with ssdeep -m.
+// Returns an error when writing failed.
+func (idx *Index) Save(w io.Writer) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	fw := NewFileWriter(w)
+	for i := range idx.entries {
+		e := &idx.entries[i]
+		if err := fw.WriteHash(e.Hash().String(), e.Filename()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load adds the hashes read from r, in the format written by Save and by ssdeep, to the
+// index, each labeled with its filename.
+// Returns an error when r could not be read or holds an invalid line, in which case no
+// hash is added.
+func (idx *Index) Load(r io.Reader) error {
+	hashes, err := NewHashReader(r, "index").ReadAll()
+	if err != nil {
+		return err
+	}
+	for i := range hashes {
+		if err := idx.Add(hashes[i].Hash().String(), hashes[i].Filename()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
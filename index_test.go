@@ -0,0 +1,94 @@
+package ssdeep
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIndexMatch(t *testing.T) {
+	idx := NewIndex()
+	assertNoError(t, idx.Add(h1, "a.exe"))
+	assertNoError(t, idx.Add(h2, "b.exe"))
+	assertNoError(t, idx.Add(h3, "family"))
+	assertNoError(t, idx.Add(h4, "family"))
+	assertError(t, idx.Add("5:abc:def", "bad"))
+	if idx.Len() != 4 {
+		t.Fatalf("Expected 4 hashes, got %d", idx.Len())
+	}
+
+	matches, err := idx.Match(h4, 50)
+	assertNoError(t, err)
+	expected := []Match{{ID: "family", Score: 100}, {ID: "family", Score: 97}}
+	if !reflect.DeepEqual(expected, matches) {
+		t.Fatalf("Matches mismatch: %+v (expected) != %+v (actual)", expected, matches)
+	}
+
+	matches, err = idx.Match(h2, 30)
+	assertNoError(t, err)
+	expected = []Match{{ID: "b.exe", Score: 100}, {ID: "a.exe", Score: 35}}
+	if !reflect.DeepEqual(expected, matches) {
+		t.Fatalf("Matches mismatch: %+v (expected) != %+v (actual)", expected, matches)
+	}
+
+	_, err = idx.Match("", 0)
+	assertError(t, err)
+}
+
+func TestIndexSaveLoad(t *testing.T) {
+	idx := NewIndex()
+	assertNoError(t, idx.Add(h1, `dir/with "quotes".bin`))
+	assertNoError(t, idx.Add(h3, "c.bin"))
+
+	var buf bytes.Buffer
+	assertNoError(t, idx.Save(&buf))
+	if !strings.HasPrefix(buf.String(), FileHeader+"\n") {
+		t.Fatalf("Missing header: %q", buf.String())
+	}
+
+	loaded := NewIndex()
+	assertNoError(t, loaded.Load(&buf))
+	if loaded.Len() != 2 {
+		t.Fatalf("Expected 2 hashes, got %d", loaded.Len())
+	}
+	matches, err := loaded.Match(h1, 1)
+	assertNoError(t, err)
+	expected := []Match{{ID: `dir/with "quotes".bin`, Score: 100}}
+	if !reflect.DeepEqual(expected, matches) {
+		t.Fatalf("Matches mismatch: %+v (expected) != %+v (actual)", expected, matches)
+	}
+
+	err = loaded.Load(strings.NewReader(h2 + "\nnot a hash\n"))
+	assertError(t, err)
+	if loaded.Len() != 2 {
+		t.Fatalf("A failed load added hashes: %d", loaded.Len())
+	}
+}
+
+func TestIndexConcurrentUse(t *testing.T) {
+	idx := NewIndex()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := idx.Add(h3, fmt.Sprintf("%d-%d", i, j)); err != nil {
+					t.Error(err)
+				}
+				if _, err := idx.Match(h4, 90); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	matches, err := idx.Match(h4, 90)
+	assertNoError(t, err)
+	if len(matches) != 400 {
+		t.Fatalf("Expected 400 matches, got %d", len(matches))
+	}
+}
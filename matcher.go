@@ -0,0 +1,270 @@
+package ssdeep
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// shingleLength is the length of the substrings two signatures must have in common
+// to be considered for a match, as in ssdeep.
+const shingleLength = int(rollingWindow)
+
+// ErrNotFound is returned when no hash is stored under an id.
+var ErrNotFound = errors.New("hash not found")
+
+// IndexStore stores the hashes searched by a Matcher.
+//
+// Candidates is the retrieval contract between the store and the Matcher: given a
+// query hash, it must return the id of every stored hash that shares at least one
+// shingle, a substring of shingleLength characters, with the query at a common
+// block size. A hash's first signature is keyed by its block size and its second
+// signature by twice its block size, so that only the signature pairs ssdeep
+// actually compares can produce a candidate. Shingles are taken from the signatures
+// with their sequences eliminated, as compared by ssdeep. Candidates must also return
+// the id of every stored hash identical to the query once sequences are eliminated,
+// which scores 100 even when its signatures are too short to have a shingle.
+// Returning extra ids is allowed as the Matcher scores every candidate, but a missing
+// id is a missed match.
+//
+// Implementations must be safe for concurrent use.
+type IndexStore interface {
+	Put(id string, h Hash) error
+	Candidates(h Hash) ([]string, error)
+	Get(id string) (Hash, error)
+}
+
+// Match is a stored hash matching a query, along with its match score.
+type Match struct {
+	ID    string
+	Score int
+}
+
+// Matcher finds the stored hashes similar to a query hash without comparing the
+// query to every stored hash.
+// Matcher is safe for concurrent use.
+type Matcher struct {
+	store IndexStore
+
+	// added holds the time each id was added at. It is kept in memory, next to
+	// the store, and is lost with the Matcher.
+	mu    sync.RWMutex
+	added map[string]time.Time
+}
+
+// NewMatcher returns a Matcher backed by store.
+// When store is nil, the hashes are kept in memory.
+func NewMatcher(store IndexStore) *Matcher {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Matcher{store: store, added: make(map[string]time.Time)}
+}
+
+// Add stores hash under id, replacing any hash previously stored under the same id.
+// The entry is tagged with the current time.
+// Returns an error when hash is not a valid signature or could not be stored.
+func (m *Matcher) Add(id, hash string) error {
+	return m.AddAt(id, hash, time.Now())
+}
+
+// AddAt is like Add, but tags the entry with t, for instance the time a threat
+// feed published the hash.
+func (m *Matcher) AddAt(id, hash string, t time.Time) error {
+	h, err := ParseHash(hash)
+	if err != nil {
+		return err
+	}
+	// The store may be slow, so it is not written under the lock: until the time is
+	// recorded, QuerySince skips the hash.
+	if err := m.store.Put(id, h); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.added[id] = t
+	m.mu.Unlock()
+	return nil
+}
+
+// Query returns the stored hashes whose match score with hash is at least threshold,
+// best match first. A zero score is never a match.
+// Returns an error when hash is not a valid signature or the store failed.
+func (m *Matcher) Query(hash string, threshold int) ([]Match, error) {
+	return m.query(hash, threshold, nil)
+}
+
+// QuerySince is like Query, but only returns the hashes added at or after since.
+// Hashes the Matcher has no time for, such as hashes stored in a persistent
+// IndexStore by a previous process or hashes still being added, are never returned.
+func (m *Matcher) QuerySince(hash string, since time.Time, threshold int) ([]Match, error) {
+	return m.query(hash, threshold, func(id string) bool {
+		m.mu.RLock()
+		t, ok := m.added[id]
+		m.mu.RUnlock()
+		return ok && !t.Before(since)
+	})
+}
+
+// query scores the candidates of hash accepted by keep, or all of them when keep is nil.
+func (m *Matcher) query(hash string, threshold int, keep func(id string) bool) ([]Match, error) {
+	h, err := ParseHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := m.store.Candidates(h)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	for _, id := range ids {
+		if keep != nil && !keep(id) {
+			continue
+		}
+		candidate, err := m.store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		score := compare(h, candidate)
+		if score > 0 && score >= threshold {
+			matches = append(matches, Match{ID: id, Score: score})
+		}
+	}
+	sortMatches(matches)
+	return matches, nil
+}
+
+func sortMatches(matches []Match) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID < matches[j].ID
+	})
+}
+
+// shingleKey identifies a shingle of a signature computed at blockSize.
+type shingleKey struct {
+	blockSize int64
+	shingle   string
+}
+
+// forEachShingle calls fn with every shingle key of h, following the IndexStore contract.
+func forEachShingle(h Hash, fn func(shingleKey)) {
+	h = h.EliminateSequences()
+	for _, part := range []struct {
+		blockSize int64
+		signature string
+	}{
+		{h.BlockSize, h.Hash1},
+		{h.BlockSize * 2, h.Hash2},
+	} {
+		for i := 0; i+shingleLength <= len(part.signature); i++ {
+			fn(shingleKey{part.blockSize, part.signature[i : i+shingleLength]})
+		}
+	}
+}
+
+// MemoryStore is an IndexStore keeping hashes and their shingles in memory.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	hashes   map[string]Hash
+	shingles map[shingleKey]map[string]struct{}
+	// exact holds the ids of the hashes with the same signatures once sequences are
+	// eliminated.
+	exact map[Hash]map[string]struct{}
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		hashes:   make(map[string]Hash),
+		shingles: make(map[shingleKey]map[string]struct{}),
+		exact:    make(map[Hash]map[string]struct{}),
+	}
+}
+
+// Put stores h under id, replacing any hash previously stored under the same id.
+func (s *MemoryStore) Put(id string, h Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.hashes[id]; ok {
+		forEachShingle(old, func(k shingleKey) {
+			delete(s.shingles[k], id)
+			if len(s.shingles[k]) == 0 {
+				delete(s.shingles, k)
+			}
+		})
+		k := old.EliminateSequences()
+		delete(s.exact[k], id)
+		if len(s.exact[k]) == 0 {
+			delete(s.exact, k)
+		}
+	}
+	s.hashes[id] = h
+	forEachShingle(h, func(k shingleKey) {
+		ids, ok := s.shingles[k]
+		if !ok {
+			ids = make(map[string]struct{})
+			s.shingles[k] = ids
+		}
+		ids[id] = struct{}{}
+	})
+	k := h.EliminateSequences()
+	ids, ok := s.exact[k]
+	if !ok {
+		ids = make(map[string]struct{})
+		s.exact[k] = ids
+	}
+	ids[id] = struct{}{}
+	return nil
+}
+
+// Candidates returns the ids of the stored hashes sharing a shingle with h.
+func (s *MemoryStore) Candidates(h Hash) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := make(map[string]struct{})
+	var ids []string
+	add := func(found map[string]struct{}) {
+		for id := range found {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		}
+	}
+	add(s.exact[h.EliminateSequences()])
+	forEachShingle(h, func(k shingleKey) {
+		add(s.shingles[k])
+	})
+	return ids, nil
+}
+
+// Get returns the hash stored under id.
+// Returns an error when no hash is stored under id.
+func (s *MemoryStore) Get(id string) (Hash, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.hashes[id]
+	if !ok {
+		return Hash{}, ErrNotFound
+	}
+	return h, nil
+}
+
+// DefaultMatcher is the Matcher used by Add and Query.
+// It suits small tools; larger applications should create their own Matcher instances
+// rather than share this global index.
+var DefaultMatcher = NewMatcher(nil)
+
+// Add stores hash under id in DefaultMatcher.
+func Add(id, hash string) error {
+	return DefaultMatcher.Add(id, hash)
+}
+
+// Query returns the hashes of DefaultMatcher matching hash with a score of at least threshold.
+func Query(hash string, threshold int) ([]Match, error) {
+	return DefaultMatcher.Query(hash, threshold)
+}
@@ -0,0 +1,197 @@
+package ssdeep
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMatcherQuery(t *testing.T) {
+	m := NewMatcher(nil)
+	assertNoError(t, m.Add("h1", h1))
+	assertNoError(t, m.Add("h2", h2))
+	assertNoError(t, m.Add("h3", h3))
+	assertNoError(t, m.Add("h4", h4))
+	assertError(t, m.Add("bad", "5:abc:def"))
+
+	matches, err := m.Query(h3, 50)
+	assertNoError(t, err)
+	expected := []Match{{ID: "h3", Score: 100}, {ID: "h4", Score: 97}}
+	if !reflect.DeepEqual(expected, matches) {
+		t.Fatalf("Matches mismatch: %+v (expected) != %+v (actual)", expected, matches)
+	}
+
+	matches, err = m.Query(h1, 0)
+	assertNoError(t, err)
+	expected = []Match{{ID: "h1", Score: 100}, {ID: "h2", Score: 35}}
+	if !reflect.DeepEqual(expected, matches) {
+		t.Fatalf("Matches mismatch: %+v (expected) != %+v (actual)", expected, matches)
+	}
+
+	_, err = m.Query("", 0)
+	assertError(t, err)
+}
+
+func TestMatcherAdjacentBlockSizes(t *testing.T) {
+	// The second signature of a hash at block size 96 is computed at block size 192.
+	m := NewMatcher(nil)
+	assertNoError(t, m.Add("small", "96:AAAAAAAAAAAAAAAAAAAAAA:QLSwbLbj41iH8nFVYv980"))
+	matches, err := m.Query("192:QLSwbLbj41iH8nFVYv980:zzzzzzz", 1)
+	assertNoError(t, err)
+	if len(matches) != 1 || matches[0].ID != "small" {
+		t.Fatalf("Expected a match on the shared signature, got %+v", matches)
+	}
+}
+
+func TestMatcherShortAndRepeatedSignatures(t *testing.T) {
+	m := NewMatcher(nil)
+	// Too short to have a shingle, but identical to the query.
+	assertNoError(t, m.Add("short", "3:abcdef:abc"))
+	// Identical to the query once sequences are eliminated.
+	assertNoError(t, m.Add("runs", "3:abcdeffffffgggggghij:abbbbbc"))
+
+	matches, err := m.Query("3:abcdef:abc", 50)
+	assertNoError(t, err)
+	expected := []Match{{ID: "short", Score: 100}}
+	if !reflect.DeepEqual(expected, matches) {
+		t.Fatalf("Matches mismatch: %+v (expected) != %+v (actual)", expected, matches)
+	}
+
+	matches, err = m.Query("3:abcdefffgggghij:abbbc", 50)
+	assertNoError(t, err)
+	expected = []Match{{ID: "runs", Score: 100}}
+	if !reflect.DeepEqual(expected, matches) {
+		t.Fatalf("Matches mismatch: %+v (expected) != %+v (actual)", expected, matches)
+	}
+
+	// The only shingle in common spans a run once it is collapsed.
+	assertNoError(t, m.Add("spanning", "3:XcdeffffffxY:XcdeffffffxY"))
+	matches, err = m.Query("3:ZcdefffxW:ZcdefffxW", 1)
+	assertNoError(t, err)
+	if len(matches) != 1 || matches[0].ID != "spanning" {
+		t.Fatalf("Expected a match on the collapsed signature, got %+v", matches)
+	}
+}
+
+func TestMemoryStorePutReplaces(t *testing.T) {
+	s := NewMemoryStore()
+	h, err := ParseHash(h3)
+	assertNoError(t, err)
+	assertNoError(t, s.Put("id", h))
+	other, err := ParseHash(h1)
+	assertNoError(t, err)
+	assertNoError(t, s.Put("id", other))
+
+	ids, err := s.Candidates(h)
+	assertNoError(t, err)
+	if len(ids) != 0 {
+		t.Fatalf("Replaced hash is still a candidate: %v", ids)
+	}
+	got, err := s.Get("id")
+	assertNoError(t, err)
+	assertHashEqual(t, h1, got.String())
+
+	_, err = s.Get("missing")
+	if err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+// blockingStore is a MemoryStore whose Put waits for release once the hash is stored.
+type blockingStore struct {
+	*MemoryStore
+	stored  chan struct{}
+	release chan struct{}
+}
+
+func (s blockingStore) Put(id string, h Hash) error {
+	err := s.MemoryStore.Put(id, h)
+	close(s.stored)
+	<-s.release
+	return err
+}
+
+func TestMatcherQuerySinceDuringAdd(t *testing.T) {
+	store := blockingStore{NewMemoryStore(), make(chan struct{}), make(chan struct{})}
+	m := NewMatcher(store)
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		if err := m.AddAt("h3", h3, t0); err != nil {
+			t.Error(err)
+		}
+	}()
+	<-store.stored
+
+	// The hash is in the store but its time is not recorded yet: the query neither
+	// waits for the store nor returns the hash.
+	matches, err := m.QuerySince(h3, t0, 50)
+	assertNoError(t, err)
+	if len(matches) != 0 {
+		t.Fatalf("Expected no match before the time is recorded, got %+v", matches)
+	}
+
+	close(store.release)
+	<-added
+	matches, err = m.QuerySince(h3, t0, 50)
+	assertNoError(t, err)
+	if len(matches) != 1 || matches[0].ID != "h3" {
+		t.Fatalf("Expected h3 to match, got %+v", matches)
+	}
+}
+
+func TestMatcherQuerySince(t *testing.T) {
+	m := NewMatcher(nil)
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assertNoError(t, m.AddAt("old", h3, t0))
+	assertNoError(t, m.AddAt("new", h4, t0.Add(24*time.Hour)))
+
+	matches, err := m.QuerySince(h3, t0.Add(time.Hour), 50)
+	assertNoError(t, err)
+	expected := []Match{{ID: "new", Score: 97}}
+	if !reflect.DeepEqual(expected, matches) {
+		t.Fatalf("Matches mismatch: %+v (expected) != %+v (actual)", expected, matches)
+	}
+
+	matches, err = m.QuerySince(h3, t0, 50)
+	assertNoError(t, err)
+	if len(matches) != 2 {
+		t.Fatalf("Expected both entries, got %+v", matches)
+	}
+
+	// Entries stored by another Matcher have no time and are never recent.
+	store := NewMemoryStore()
+	assertNoError(t, NewMatcher(store).Add("other", h3))
+	matches, err = NewMatcher(store).QuerySince(h3, time.Time{}, 0)
+	assertNoError(t, err)
+	if len(matches) != 0 {
+		t.Fatalf("Expected no match, got %+v", matches)
+	}
+}
+
+func TestDefaultMatcher(t *testing.T) {
+	defer func(m *Matcher) { DefaultMatcher = m }(DefaultMatcher)
+	DefaultMatcher = NewMatcher(nil)
+
+	var wg sync.WaitGroup
+	for i, h := range []string{h1, h2, h3, h4} {
+		wg.Add(1)
+		go func(id, h string) {
+			defer wg.Done()
+			if err := Add(id, h); err != nil {
+				t.Error(err)
+			}
+		}(fmt.Sprint("h", i+1), h)
+	}
+	wg.Wait()
+
+	matches, err := Query(h4, 90)
+	assertNoError(t, err)
+	expected := []Match{{ID: "h4", Score: 100}, {ID: "h3", Score: 97}}
+	if !reflect.DeepEqual(expected, matches) {
+		t.Fatalf("Matches mismatch: %+v (expected) != %+v (actual)", expected, matches)
+	}
+}
@@ -0,0 +1,77 @@
+package ssdeep
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidPattern is returned when a HashPattern constraint can never be satisfied.
+var ErrInvalidPattern = errors.New("invalid hash pattern")
+
+// HashPattern is a coarse rule matching a family of hashes rather than a single one,
+// for instance "any hash with a block size between 96 and 384 that contains these
+// fragments". All the constraints set on a pattern must hold for a hash to match;
+// the zero value of a constraint disables it.
+type HashPattern struct {
+	// MinBlockSize and MaxBlockSize bound the block size of matching hashes.
+	MinBlockSize int64
+	MaxBlockSize int64
+	// Substrings must each appear in one of the two signatures of matching hashes.
+	Substrings []string
+	// Reference is a signature, or a fragment of one, whose shingles are looked
+	// up in matching hashes.
+	Reference string
+	// MinSharedShingles is the number of distinct shingles of Reference, substrings
+	// of 7 characters, that must appear in the signatures of matching hashes.
+	MinSharedShingles int
+}
+
+func (p HashPattern) validate() error {
+	if p.MinBlockSize < 0 || p.MaxBlockSize < 0 || p.MinSharedShingles < 0 {
+		return ErrInvalidPattern
+	}
+	if p.MaxBlockSize > 0 && p.MinBlockSize > p.MaxBlockSize {
+		return ErrInvalidPattern
+	}
+	if p.MinSharedShingles > 0 && len(p.Reference) < shingleLength {
+		return ErrInvalidPattern
+	}
+	return nil
+}
+
+// MatchPattern reports whether hash satisfies every constraint of pattern.
+// Returns an error when hash is not a valid signature or pattern can never match.
+func MatchPattern(hash string, pattern HashPattern) (bool, error) {
+	if err := pattern.validate(); err != nil {
+		return false, err
+	}
+	h, err := ParseHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	if h.BlockSize < pattern.MinBlockSize {
+		return false, nil
+	}
+	if pattern.MaxBlockSize > 0 && h.BlockSize > pattern.MaxBlockSize {
+		return false, nil
+	}
+	for _, s := range pattern.Substrings {
+		if !strings.Contains(h.Hash1, s) && !strings.Contains(h.Hash2, s) {
+			return false, nil
+		}
+	}
+	if pattern.MinSharedShingles > 0 {
+		shared := make(map[string]struct{})
+		for i := 0; i+shingleLength <= len(pattern.Reference); i++ {
+			shingle := pattern.Reference[i : i+shingleLength]
+			if strings.Contains(h.Hash1, shingle) || strings.Contains(h.Hash2, shingle) {
+				shared[shingle] = struct{}{}
+			}
+		}
+		if len(shared) < pattern.MinSharedShingles {
+			return false, nil
+		}
+	}
+	return true, nil
+}
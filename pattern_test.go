@@ -0,0 +1,41 @@
+package ssdeep
+
+import "testing"
+
+func TestMatchPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern  HashPattern
+		expected bool
+	}{
+		{HashPattern{}, true},
+		{HashPattern{MinBlockSize: 96, MaxBlockSize: 384}, true},
+		{HashPattern{MinBlockSize: 384}, false},
+		{HashPattern{MaxBlockSize: 96}, false},
+		{HashPattern{Substrings: []string{"6+wNQ7Q40L", "CllivQ"}}, true},
+		{HashPattern{Substrings: []string{"6+wNQ7Q40L", "zzzz"}}, false},
+		// h2 shares "6+wNQ7Q40L/i" with h1, that is 6 shingles.
+		{HashPattern{Reference: "JkjRcePWsNVQza3ntZStn5VfsoXMhRD9+xJMinqF6+wNQ7Q40L/i737rPVt", MinSharedShingles: 6}, true},
+		{HashPattern{Reference: "JkjRcePWsNVQza3ntZStn5VfsoXMhRD9+xJMinqF6+wNQ7Q40L/i737rPVt", MinSharedShingles: 7}, false},
+	} {
+		ok, err := MatchPattern(h1, tc.pattern)
+		assertNoError(t, err)
+		if ok != tc.expected {
+			t.Errorf("%+v: expected %t, got %t", tc.pattern, tc.expected, ok)
+		}
+	}
+}
+
+func TestMatchPatternInvalid(t *testing.T) {
+	for _, p := range []HashPattern{
+		{MinBlockSize: 384, MaxBlockSize: 96},
+		{MinBlockSize: -1},
+		{MinSharedShingles: 1, Reference: "abc"},
+	} {
+		_, err := MatchPattern(h1, p)
+		if err != ErrInvalidPattern {
+			t.Errorf("%+v: expected ErrInvalidPattern, got %v", p, err)
+		}
+	}
+	_, err := MatchPattern("", HashPattern{})
+	assertError(t, err)
+}
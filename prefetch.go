@@ -0,0 +1,145 @@
+package ssdeep
+
+import (
+	"errors"
+	"io"
+)
+
+// ReaderAtOption configures how FuzzyReaderAt reads its input.
+type ReaderAtOption func(*readerAtOptions)
+
+type readerAtOptions struct {
+	chunkSize int
+	depth     int
+}
+
+// WithPrefetch makes FuzzyReaderAt read the input in chunks of chunkSize bytes on a
+// background goroutine, keeping up to depth chunks ready ahead of the hash loop.
+// This hides the latency of sources where each ReadAt call is expensive, such as
+// cloud object storage, behind the hash computation.
+func WithPrefetch(chunkSize, depth int) ReaderAtOption {
+	return func(o *readerAtOptions) {
+		o.chunkSize = chunkSize
+		o.depth = depth
+	}
+}
+
+// FuzzyReaderAt computes the fuzzy hash of the first size bytes of a ReaderAt.
+// By default the input is read synchronously; see WithPrefetch for latency-bound sources.
+// It is the caller's responsibility to append the filename, if any, to result after computation.
+// Returns an error when ssdeep could not be computed on the ReaderAt.
+func FuzzyReaderAt(r io.ReaderAt, size int64, opts ...ReaderAtOption) (string, error) {
+	var o readerAtOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.chunkSize <= 0 {
+		return FuzzyReader(io.NewSectionReader(r, 0, size), size)
+	}
+	if o.depth <= 0 {
+		o.depth = 1
+	}
+	p := &prefetchReader{r: r, size: size, chunkSize: o.chunkSize, depth: o.depth}
+	defer p.stop()
+	return FuzzyReader(p, size)
+}
+
+type prefetchChunk struct {
+	data []byte
+	err  error
+}
+
+// prefetchReader adapts a ReaderAt into a Reader whose data is fetched ahead of
+// time in large chunks. Seeking discards the prefetched chunks and restarts the
+// fetcher at the new offset on the next Read.
+type prefetchReader struct {
+	r         io.ReaderAt
+	size      int64
+	chunkSize int
+	depth     int
+	off       int64
+	buf       []byte
+	err       error
+	chunks    chan prefetchChunk
+	done      chan struct{}
+}
+
+func (p *prefetchReader) start() {
+	p.chunks = make(chan prefetchChunk, p.depth)
+	p.done = make(chan struct{})
+	go p.fetch(p.off, p.chunks, p.done)
+}
+
+func (p *prefetchReader) stop() {
+	if p.chunks == nil {
+		return
+	}
+	close(p.done)
+	p.chunks = nil
+	p.done = nil
+}
+
+func (p *prefetchReader) fetch(off int64, chunks chan<- prefetchChunk, done <-chan struct{}) {
+	defer close(chunks)
+	for off < p.size {
+		n := int64(p.chunkSize)
+		if rem := p.size - off; rem < n {
+			n = rem
+		}
+		data := make([]byte, n)
+		m, err := p.r.ReadAt(data, off)
+		if err == io.EOF && int64(m) == n {
+			err = nil
+		}
+		select {
+		case chunks <- prefetchChunk{data: data[:m], err: err}:
+		case <-done:
+			return
+		}
+		if err != nil {
+			return
+		}
+		off += int64(m)
+	}
+}
+
+func (p *prefetchReader) Read(b []byte) (int, error) {
+	if p.chunks == nil && p.err == nil {
+		p.start()
+	}
+	for len(p.buf) == 0 {
+		if p.err != nil {
+			return 0, p.err
+		}
+		c, ok := <-p.chunks
+		if !ok {
+			p.err = io.EOF
+			continue
+		}
+		p.buf, p.err = c.data, c.err
+	}
+	n := copy(b, p.buf)
+	p.buf = p.buf[n:]
+	p.off += int64(n)
+	return n, nil
+}
+
+func (p *prefetchReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += p.off
+	case io.SeekEnd:
+		offset += p.size
+	default:
+		return p.off, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return p.off, errors.New("negative position")
+	}
+	p.stop()
+	p.off = offset
+	p.buf = nil
+	p.err = nil
+	return offset, nil
+}
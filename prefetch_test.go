@@ -0,0 +1,62 @@
+package ssdeep
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+type latencyReaderAt struct {
+	r     *bytes.Reader
+	delay time.Duration
+}
+
+func (l latencyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	time.Sleep(l.delay)
+	return l.r.ReadAt(p, off)
+}
+
+func TestFuzzyReaderAtMatchesFuzzyBytes(t *testing.T) {
+	blob := make([]byte, 300000)
+	rand.Read(blob)
+	expected, err := FuzzyBytes(blob)
+	assertNoError(t, err)
+
+	r := bytes.NewReader(blob)
+	result, err := FuzzyReaderAt(r, int64(len(blob)))
+	assertNoError(t, err)
+	assertHashEqual(t, expected, result)
+
+	for _, chunkSize := range []int{1, 1000, 4096, 65536, len(blob) * 2} {
+		result, err := FuzzyReaderAt(r, int64(len(blob)), WithPrefetch(chunkSize, 4))
+		assertNoError(t, err)
+		assertHashEqual(t, expected, result)
+	}
+}
+
+func TestFuzzyReaderAtSmallInput(t *testing.T) {
+	_, err := FuzzyReaderAt(bytes.NewReader(make([]byte, 100)), 100, WithPrefetch(4096, 2))
+	assertError(t, err)
+}
+
+func benchmarkFuzzyReaderAt(b *testing.B, opts ...ReaderAtOption) {
+	blob := make([]byte, 1024*1024)
+	rand.Read(blob)
+	r := latencyReaderAt{r: bytes.NewReader(blob), delay: 100 * time.Microsecond}
+	b.SetBytes(int64(len(blob)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := FuzzyReaderAt(r, int64(len(blob)), opts...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFuzzyReaderAtSync(b *testing.B) {
+	benchmarkFuzzyReaderAt(b)
+}
+
+func BenchmarkFuzzyReaderAtPrefetch(b *testing.B) {
+	benchmarkFuzzyReaderAt(b, WithPrefetch(256*1024, 4))
+}
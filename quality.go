@@ -0,0 +1,57 @@
+package ssdeep
+
+import (
+	"bytes"
+	"math"
+)
+
+// Normalized entropy above which the input is considered compressed or
+// encrypted, and at which it no longer gives any quality.
+const (
+	highEntropy = 0.9
+	maxEntropy  = 1.0
+)
+
+// HashQuality estimates how meaningful the fuzzy hash of buf is for similarity
+// comparisons, as a value between 0 (unreliable) and 1 (reliable).
+// The estimate combines two heuristics: how many block boundaries were hit compared
+// to the maximum length of the first signature, as short signatures carry little
+// information, and the entropy of the data, as compressed or encrypted inputs spread
+// any change over the whole file and defeat piecewise hashing.
+// Returns an error when the fuzzy hash of buf could not be computed.
+func HashQuality(buf []byte) (float64, error) {
+	result, err := fuzzyReaderDetailed(bytes.NewReader(buf), int64(len(buf)), Options{})
+	if err != nil {
+		return 0, err
+	}
+
+	lengthScore := math.Min(float64(result.BoundaryHits)/spamSumLength, 1)
+
+	e := entropy(buf) / 8
+	entropyScore := 1.0
+	if e > highEntropy {
+		entropyScore = (maxEntropy - e) / (maxEntropy - highEntropy)
+	}
+	return lengthScore * math.Max(entropyScore, 0), nil
+}
+
+// entropy computes the Shannon entropy of buf in bits per byte.
+func entropy(buf []byte) float64 {
+	if len(buf) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range buf {
+		counts[b]++
+	}
+	var e float64
+	n := float64(len(buf))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		e -= p * math.Log2(p)
+	}
+	return e
+}
@@ -0,0 +1,42 @@
+package ssdeep
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestEntropy(t *testing.T) {
+	if e := entropy(make([]byte, 100)); e != 0 {
+		t.Errorf("Constant data should have no entropy, got %f", e)
+	}
+	buf := make([]byte, 256*16)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	if e := entropy(buf); e != 8 {
+		t.Errorf("Uniform data should have 8 bits of entropy, got %f", e)
+	}
+}
+
+func TestHashQuality(t *testing.T) {
+	b, err := ioutil.ReadFile("LICENSE")
+	assertNoError(t, err)
+	b = concatCopyPreAllocate([][]byte{b, b})
+	q, err := HashQuality(b)
+	assertNoError(t, err)
+	if q < 0.8 {
+		t.Errorf("Text should give a reliable hash, got quality %f", q)
+	}
+
+	random := make([]byte, 1024*1024)
+	rand.Read(random)
+	q, err = HashQuality(random)
+	assertNoError(t, err)
+	if q > 0.1 {
+		t.Errorf("Random data should give an unreliable hash, got quality %f", q)
+	}
+
+	_, err = HashQuality(b[:10])
+	assertError(t, err)
+}
@@ -0,0 +1,91 @@
+package ssdeep
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// sampleChunkSize is the size of the blocks FuzzyFileSampled picks from a file.
+const sampleChunkSize = 64 << 10
+
+// FuzzyFileSampled computes an approximate fuzzy hash of a file by only hashing one block
+// of 64 KiB out of every sampleRate, starting with the first one. The sampled blocks are
+// always the same for a given file size and rate, so the result is deterministic.
+// Sampled hashes are much faster to compute on large files but have a lower fidelity, and
+// they are only comparable to hashes of other files sampled at the same rate: they suit a
+// first triage pass, with full hashes computed for the candidates it finds.
+// A sampleRate of 1 or less hashes the whole file, like FuzzyFile.
+// The file pointer is left untouched.
+// Returns an error when the sampled data is too small or ssdeep could not be computed on it.
+func FuzzyFileSampled(f *os.File, sampleRate int) (string, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if sampleRate < 1 {
+		sampleRate = 1
+	}
+	r := newSampledReader(f, stat.Size(), int64(sampleRate))
+	return FuzzyReader(r, r.total)
+}
+
+// sampledReader reads the sampled blocks of a ReaderAt as one contiguous input.
+type sampledReader struct {
+	r    io.ReaderAt
+	rate int64
+	// total is the number of sampled bytes and off the current position among them.
+	total int64
+	off   int64
+}
+
+func newSampledReader(r io.ReaderAt, size, rate int64) *sampledReader {
+	s := &sampledReader{r: r, rate: rate}
+	stride := rate * sampleChunkSize
+	full := size / stride
+	s.total = full * sampleChunkSize
+	if rem := size - full*stride; rem > sampleChunkSize {
+		s.total += sampleChunkSize
+	} else {
+		s.total += rem
+	}
+	return s
+}
+
+func (s *sampledReader) Read(p []byte) (int, error) {
+	if s.off >= s.total {
+		return 0, io.EOF
+	}
+	within := s.off % sampleChunkSize
+	n := int64(len(p))
+	if rem := sampleChunkSize - within; n > rem {
+		n = rem
+	}
+	if rem := s.total - s.off; n > rem {
+		n = rem
+	}
+	physical := s.off/sampleChunkSize*s.rate*sampleChunkSize + within
+	m, err := s.r.ReadAt(p[:n], physical)
+	s.off += int64(m)
+	if err == io.EOF && int64(m) == n {
+		err = nil
+	}
+	return m, err
+}
+
+func (s *sampledReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.off
+	case io.SeekEnd:
+		offset += s.total
+	default:
+		return s.off, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return s.off, errors.New("negative position")
+	}
+	s.off = offset
+	return offset, nil
+}
@@ -0,0 +1,58 @@
+package ssdeep
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestFuzzyFileSampled(t *testing.T) {
+	size := 10*sampleChunkSize + 1000
+	blob := make([]byte, size)
+	rand.Read(blob)
+	f, err := ioutil.TempFile("", "ssdeep")
+	assertNoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = f.Write(blob)
+	assertNoError(t, err)
+
+	expected, err := FuzzyBytes(blob)
+	assertNoError(t, err)
+	result, err := FuzzyFileSampled(f, 1)
+	assertNoError(t, err)
+	assertHashEqual(t, expected, result)
+
+	// With a rate of 3, blocks 0, 3, 6 and 9 are hashed, the last one being partial.
+	for _, tc := range []struct {
+		rate   int
+		blocks []int
+	}{
+		{3, []int{0, 3, 6, 9}},
+		{4, []int{0, 4, 8}},
+		{10, []int{0, 10}},
+	} {
+		var sampled [][]byte
+		for _, b := range tc.blocks {
+			end := (b + 1) * sampleChunkSize
+			if end > size {
+				end = size
+			}
+			sampled = append(sampled, blob[b*sampleChunkSize:end])
+		}
+		expected, err := FuzzyByteSlices(sampled...)
+		assertNoError(t, err)
+		result, err := FuzzyFileSampled(f, tc.rate)
+		assertNoError(t, err)
+		assertHashEqual(t, expected, result)
+	}
+}
+
+func TestFuzzyFileSampledTooSmall(t *testing.T) {
+	f, err := os.Open("LICENSE")
+	assertNoError(t, err)
+	defer f.Close()
+	_, err = FuzzyFileSampled(f, 4)
+	assertError(t, err)
+}
@@ -1,10 +1,12 @@
 package ssdeep
 
 import (
+	"errors"
+	"fmt"
 	"math"
-	"strings"
+	"math/rand"
 	"strconv"
-	"errors"
+	"strings"
 )
 
 // Distance computes the match score between two fuzzy hash signatures.
@@ -21,23 +23,115 @@ func Distance(hash1, hash2 string) (score int, err error) {
 		return
 	}
 
-	if hash1BlockSize == hash2BlockSize && hash1String1 == hash2String1 {
-		return 100, nil
+	score = compare(
+		Hash{BlockSize: int64(hash1BlockSize), Hash1: hash1String1, Hash2: hash1String2},
+		Hash{BlockSize: int64(hash2BlockSize), Hash1: hash2String1, Hash2: hash2String2},
+	)
+	return
+}
+
+// HashDistance computes the match score between two parsed signatures, as Distance does
+// for their string forms. Services matching the same hashes many times can parse them
+// once and skip the parsing on every comparison.
+// Returns a value from zero to 100 indicating the match score of the two signatures.
+func HashDistance(a, b Hash) int {
+	return compare(a, b)
+}
+
+// Compare computes the match score between two fuzzy hash signatures, giving the same
+// scores as fuzzy_compare in libfuzzy and thus the ssdeep tool.
+// Signatures can only match when their block sizes are equal or differ by a factor of
+// two; they are then scored by the weighted edit distance of the signatures computed at
+// the common block size, provided they share a substring of 7 characters, and the score
+// is capped at small block sizes.
+// Unlike Distance, both signatures are validated with ParseHash first, so a signature
+// whose block size is not part of the blockMin * 2^n progression is rejected rather
+// than compared.
+// Returns a value from zero to 100 indicating the match score of the two signatures.
+// Returns an error when one of the inputs is not a valid signature.
+func Compare(hash1, hash2 string) (int, error) {
+	h1, err := ParseHash(hash1)
+	if err != nil {
+		return 0, err
+	}
+	h2, err := ParseHash(hash2)
+	if err != nil {
+		return 0, err
+	}
+	return compare(h1, h2), nil
+}
+
+// CompareUntrusted computes the match score between two fuzzy hash signatures
+// received from an untrusted source, such as a network API.
+// On top of the validation done by Compare, it rejects oversized input, characters
+// outside of the base64 alphabet and signatures longer than ssdeep produces, so the
+// work done is bounded whatever the input.
+// Returns an error when one of the inputs is not a valid signature.
+func CompareUntrusted(hash1, hash2 string) (int, error) {
+	h1, err := ParseUntrusted(hash1)
+	if err != nil {
+		return 0, err
+	}
+	h2, err := ParseUntrusted(hash2)
+	if err != nil {
+		return 0, err
+	}
+	return compare(h1, h2), nil
+}
+
+// CompareOptions tunes how Compare scores two signatures.
+// The zero value gives the same scores as ssdeep.
+type CompareOptions struct {
+	// MinCommonSubstring is the length of the substring two signatures must share to
+	// be scored at all. A longer substring makes the prefilter stricter, with fewer
+	// candidates but possibly missed matches; a shorter one makes it more permissive.
+	// Zero stands for 7, the length used by ssdeep.
+	MinCommonSubstring int
+}
+
+// CompareWithOptions computes the match score between two fuzzy hash signatures like
+// Compare, tuned by opts.
+// Returns an error when one of the inputs is not a valid signature.
+func CompareWithOptions(hash1, hash2 string, opts CompareOptions) (int, error) {
+	h1, err := ParseHash(hash1)
+	if err != nil {
+		return 0, err
+	}
+	h2, err := ParseHash(hash2)
+	if err != nil {
+		return 0, err
+	}
+	return opts.compare(h1, h2), nil
+}
+
+func compare(h1, h2 Hash) int {
+	return CompareOptions{}.compare(h1, h2)
+}
+
+func (opts CompareOptions) compare(h1, h2 Hash) (score int) {
+	minCommon := opts.MinCommonSubstring
+	if minCommon <= 0 {
+		minCommon = shingleLength
+	}
+
+	h1, h2 = h1.EliminateSequences(), h2.EliminateSequences()
+	if h1 == h2 {
+		return 100
 	}
 
 	// We can only compare equal or *2 block sizes
-	if hash1BlockSize != hash2BlockSize && hash1BlockSize != hash2BlockSize*2 && hash2BlockSize != hash1BlockSize*2 {
+	if h1.BlockSize != h2.BlockSize && h1.BlockSize != h2.BlockSize*2 && h2.BlockSize != h1.BlockSize*2 {
 		return
 	}
 
-	if hash1BlockSize == hash2BlockSize {
-		d1 := scoreDistance(hash1String1, hash2String1, hash1BlockSize)
-		d2 := scoreDistance(hash1String2, hash2String2, hash1BlockSize*2)
+	if h1.BlockSize == h2.BlockSize {
+		d1 := scoreDistance(h1.Hash1, h2.Hash1, h1.BlockSize, minCommon)
+		d2 := scoreDistance(h1.Hash2, h2.Hash2, h1.BlockSize*2, minCommon)
 		score = int(math.Max(float64(d1), float64(d2)))
-	} else if hash1BlockSize == hash2BlockSize*2 {
-		score = scoreDistance(hash1String1, hash2String2, hash1BlockSize)
+	} else if h1.BlockSize == h2.BlockSize*2 {
+		score = scoreDistance(h1.Hash1, h2.Hash2, h1.BlockSize, minCommon)
 	} else {
-		score = scoreDistance(hash1String2, hash2String1, hash2BlockSize)
+		score = scoreDistance(h1.Hash2, h2.Hash1, h2.BlockSize, minCommon)
 	}
 	return
 }
@@ -65,16 +159,215 @@ func splitSsdeep(hash string) (blockSize int, hashString1, hashString2 string, e
 	return
 }
 
-func scoreDistance(h1, h2 string, blockSize int) int {
+// scoreDistance scores two signatures computed at blockSize like score_strings in libfuzzy.
+func scoreDistance(h1, h2 string, blockSize int64, minCommon int) int {
+	if len(h1) > spamSumLength || len(h2) > spamSumLength {
+		return 0
+	}
+	// Like ssdeep, only score signatures that have a substring in common
+	if !hasCommonSubstring(h1, h2, minCommon) {
+		return 0
+	}
 	d := distance(h1, h2)
 	d = (d * spamSumLength) / (len(h1) + len(h2))
 	d = (100 * d) / spamSumLength
+	if d >= 100 {
+		return 0
+	}
 	d = 100 - d
-	/* TODO: Figure out this black magic...
-	matchSize := float64(blockSize) / float64(blockMin) * math.Min(float64(len(h1)), float64(len(h2)))
-	if d > int(matchSize) {
+
+	// At small block sizes, signatures are short and similar by chance, so the score is
+	// capped by how much data the shortest signature can actually describe.
+	if blockSize >= (99+int64(rollingWindow))/int64(rollingWindow)*blockMin {
+		return d
+	}
+	matchSize := blockSize / blockMin * int64(min(len(h1), len(h2), spamSumLength))
+	if int64(d) > matchSize {
 		d = int(matchSize)
 	}
-	*/
 	return d
 }
+
+// hasCommonSubstring reports whether s1 and s2 share a substring of n characters.
+func hasCommonSubstring(s1, s2 string, n int) bool {
+	for i := 0; i+n <= len(s1); i++ {
+		if strings.Contains(s2, s1[i:i+n]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Incompatibility explains why two fuzzy hash signatures cannot match.
+// Returns an empty string when the signatures are comparable, that is when their
+// block sizes are equal or differ by a factor of two and the signatures compared at
+// the common block size share a substring of 7 characters.
+// Returns an error when one of the inputs is not a valid signature.
+func Incompatibility(hash1, hash2 string) (string, error) {
+	h1, err := ParseHash(hash1)
+	if err != nil {
+		return "", err
+	}
+	h2, err := ParseHash(hash2)
+	if err != nil {
+		return "", err
+	}
+
+	h1, h2 = h1.EliminateSequences(), h2.EliminateSequences()
+	var common bool
+	switch {
+	case h1.BlockSize == h2.BlockSize:
+		common = h1 == h2 ||
+			hasCommonSubstring(h1.Hash1, h2.Hash1, shingleLength) ||
+			hasCommonSubstring(h1.Hash2, h2.Hash2, shingleLength)
+	case h1.BlockSize == h2.BlockSize*2:
+		common = hasCommonSubstring(h1.Hash1, h2.Hash2, shingleLength)
+	case h2.BlockSize == h1.BlockSize*2:
+		common = hasCommonSubstring(h1.Hash2, h2.Hash1, shingleLength)
+	default:
+		return fmt.Sprintf("block sizes %d and %d differ by more than 2x", h1.BlockSize, h2.BlockSize), nil
+	}
+	if !common {
+		return fmt.Sprintf("no common %d-char substring", shingleLength), nil
+	}
+	return "", nil
+}
+
+// LongestCommonSignature returns the longest substring shared by the signatures that
+// are compared for the two hashes, after sequence elimination. It is the concrete
+// fingerprint fragment driving a match.
+// Returns an empty string when the block sizes are not compatible or nothing is shared.
+// Returns an error when one of the inputs is not a valid signature.
+func LongestCommonSignature(hash1, hash2 string) (string, error) {
+	h1, err := ParseHash(hash1)
+	if err != nil {
+		return "", err
+	}
+	h2, err := ParseHash(hash2)
+	if err != nil {
+		return "", err
+	}
+	h1, h2 = h1.EliminateSequences(), h2.EliminateSequences()
+
+	switch {
+	case h1.BlockSize == h2.BlockSize:
+		s1 := longestCommonSubstring(h1.Hash1, h2.Hash1)
+		s2 := longestCommonSubstring(h1.Hash2, h2.Hash2)
+		if len(s2) > len(s1) {
+			return s2, nil
+		}
+		return s1, nil
+	case h1.BlockSize == h2.BlockSize*2:
+		return longestCommonSubstring(h1.Hash1, h2.Hash2), nil
+	case h2.BlockSize == h1.BlockSize*2:
+		return longestCommonSubstring(h1.Hash2, h2.Hash1), nil
+	}
+	return "", nil
+}
+
+// longestCommonSubstring returns the first longest substring of s1 also found in s2.
+func longestCommonSubstring(s1, s2 string) string {
+	// lengths[j+1] is the length of the common suffix of s1[:i+1] and s2[:j+1].
+	lengths := make([]int, len(s2)+1)
+	best, end := 0, 0
+	for i := 0; i < len(s1); i++ {
+		for j := len(s2) - 1; j >= 0; j-- {
+			if s1[i] != s2[j] {
+				lengths[j+1] = 0
+				continue
+			}
+			lengths[j+1] = lengths[j] + 1
+			if lengths[j+1] > best {
+				best, end = lengths[j+1], i+1
+			}
+		}
+	}
+	return s1[end-best : end]
+}
+
+// PairScore is the match score of two hashes, identified by their index in the
+// slice they were sampled from.
+type PairScore struct {
+	I     int
+	J     int
+	Score int
+}
+
+// SamplePairs picks n random pairs of distinct hashes and computes their match score.
+// Pairs are drawn with replacement from a generator seeded with seed, so the same
+// input and seed always produce the same sample.
+// Pairs that cannot be compared, because one of the hashes is not a valid signature, get a score of zero.
+// Returns nil when there are fewer than two hashes to pick from.
+func SamplePairs(hashes []string, n int, seed int64) []PairScore {
+	if len(hashes) < 2 || n <= 0 {
+		return nil
+	}
+	r := rand.New(rand.NewSource(seed))
+	pairs := make([]PairScore, n)
+	for k := range pairs {
+		i := r.Intn(len(hashes))
+		j := r.Intn(len(hashes) - 1)
+		if j >= i {
+			j++
+		}
+		score, _ := Distance(hashes[i], hashes[j])
+		pairs[k] = PairScore{I: i, J: j, Score: score}
+	}
+	return pairs
+}
+
+// Segment is a range of Length bytes starting at Offset.
+type Segment struct {
+	Offset int64
+	Length int64
+}
+
+// CompareIgnoringRange computes the match score of two buffers after zeroing the
+// ignored segments in both of them, so that volatile regions such as build
+// timestamps or embedded paths do not affect the result.
+// Segments extending past the end of a buffer are truncated. The input buffers are not modified.
+// Returns an error when one of the buffers could not be hashed.
+func CompareIgnoringRange(a, b []byte, ignore []Segment) (int, error) {
+	h1, err := FuzzyBytes(maskSegments(a, ignore))
+	if err != nil {
+		return 0, err
+	}
+	h2, err := FuzzyBytes(maskSegments(b, ignore))
+	if err != nil {
+		return 0, err
+	}
+	return Compare(h1, h2)
+}
+
+func maskSegments(buffer []byte, segments []Segment) []byte {
+	masked := make([]byte, len(buffer))
+	copy(masked, buffer)
+	size := int64(len(masked))
+	for _, s := range segments {
+		if s.Offset < 0 || s.Length <= 0 || s.Offset >= size {
+			continue
+		}
+		end := s.Offset + s.Length
+		if end > size || end < s.Offset {
+			end = size
+		}
+		for i := s.Offset; i < end; i++ {
+			masked[i] = 0
+		}
+	}
+	return masked
+}
+
+// CompareDistance computes a distance between two fuzzy hash signatures in [0, 1], as
+// 1 - score/100 where score is the match score returned by Compare. Identical signatures
+// are at distance 0, while signatures that cannot match, such as signatures with
+// incompatible block sizes, are at distance 1. It can be used directly as the distance
+// function of clustering algorithms.
+// Returns a distance of 1 along with an error when one of the inputs is not a valid signature.
+func CompareDistance(hash1, hash2 string) (float64, error) {
+	score, err := Compare(hash1, hash2)
+	if err != nil {
+		return 1, err
+	}
+	return 1 - float64(score)/100, nil
+}
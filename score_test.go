@@ -1,6 +1,11 @@
 package ssdeep
 
-import "testing"
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
 
 var h1 = "192:MUPMinqP6+wNQ7Q40L/iB3n2rIBrP0GZKF4jsef+0FVQLSwbLbj41iH8nFVYv980:x0CllivQiFmt"
 
@@ -73,3 +78,379 @@ func BenchmarkDistance(b *testing.B) {
 		distance(h1, h2)
 	}
 }
+
+func TestSamplePairsDeterministic(t *testing.T) {
+	hashes := []string{h1, h2, h3, h4}
+	p1 := SamplePairs(hashes, 20, 42)
+	p2 := SamplePairs(hashes, 20, 42)
+	if len(p1) != 20 {
+		t.Fatalf("Expected 20 pairs, got %d", len(p1))
+	}
+	for k := range p1 {
+		if p1[k] != p2[k] {
+			t.Fatalf("Sample %d differs: %+v != %+v", k, p1[k], p2[k])
+		}
+		if p1[k].I == p1[k].J {
+			t.Fatalf("Sample %d pairs a hash with itself: %+v", k, p1[k])
+		}
+		d, _ := Distance(hashes[p1[k].I], hashes[p1[k].J])
+		assertDistanceEqual(t, d, p1[k].Score)
+	}
+}
+
+func TestSamplePairsTooFewHashes(t *testing.T) {
+	if p := SamplePairs([]string{h1}, 10, 1); p != nil {
+		t.Errorf("Expected no pairs, got %+v", p)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	d, err := Compare(h3, h4)
+	assertNoError(t, err)
+	assertDistanceEqual(t, 97, d)
+}
+
+func TestCompareInvalidBlockSize(t *testing.T) {
+	h := "5:pDSC8olnoL1v/uawvbQD7XlZUFYzYyMb615NktYHF7dREN:5DHoJXv7XOq7Mb2TwYHXREN"
+	d, err := Compare(h, "6:pDSC8olnoL1v/uawvbQD7XlZUFYzYyMb615NktYHF7dREN:5DHoJXv7XOq7Mb2TwYHXREN")
+	if err != ErrInvalidBlockSize {
+		t.Fatalf("Expected ErrInvalidBlockSize, got %v", err)
+	}
+	assertDistanceEqual(t, 0, d)
+}
+
+func TestCompareIgnoringRange(t *testing.T) {
+	a := make([]byte, 20000)
+	rand.Read(a)
+	b := make([]byte, len(a))
+	copy(b, a)
+	// Scatter differences over the header so the hashes diverge.
+	for i := 0; i < 4096; i += 64 {
+		b[i] ^= 0xff
+	}
+
+	d, err := CompareIgnoringRange(a, b, nil)
+	assertNoError(t, err)
+	if d == 100 {
+		t.Fatal("Buffers differing in their header should not score 100")
+	}
+
+	ignore := []Segment{{Offset: 0, Length: 4096}}
+	d, err = CompareIgnoringRange(a, b, ignore)
+	assertNoError(t, err)
+	assertDistanceEqual(t, 100, d)
+
+	if a[0] == b[0] {
+		t.Fatal("Input buffers must not be modified")
+	}
+}
+
+func BenchmarkCompare(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Compare(h3, h4)
+		Compare(h1, h2)
+	}
+}
+
+// naiveDistance is the textbook full-matrix weighted edit distance.
+func naiveDistance(s1, s2 string) int {
+	d := make([][]int, len(s1)+1)
+	for i := range d {
+		d[i] = make([]int, len(s2)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s1); i++ {
+		for j := 1; j <= len(s2); j++ {
+			cost := 0
+			if s1[i-1] != s2[j-1] {
+				cost = 2
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+		}
+	}
+	return d[len(s1)][len(s2)]
+}
+
+func TestDistanceMatchesFullMatrix(t *testing.T) {
+	assertDistanceEqual(t, 5, distance("kitten", "sitting"))
+	assertDistanceEqual(t, 3, distance("", "abc"))
+	assertDistanceEqual(t, 3, distance("abc", ""))
+	// Non-ASCII strings are compared rune-wise.
+	assertDistanceEqual(t, 2, distance("café", "cafe"))
+	assertDistanceEqual(t, 1, distance("日本", "日本語"))
+
+	r := rand.New(rand.NewSource(1))
+	randomString := func() string {
+		b := make([]byte, r.Intn(spamSumLength+1))
+		for i := range b {
+			b[i] = b64String[r.Intn(4)]
+		}
+		return string(b)
+	}
+	for i := 0; i < 1000; i++ {
+		s1, s2 := randomString(), randomString()
+		assertDistanceEqual(t, naiveDistance(s1, s2), distance(s1, s2))
+	}
+}
+
+func TestCompareSimilarity(t *testing.T) {
+	s, err := CompareSimilarity(h3, h4)
+	assertNoError(t, err)
+	assertDistanceEqual(t, 97, s.Percent())
+	if !s.IsMatch(90) || s.IsMatch(98) {
+		t.Errorf("Unexpected match result for %d", s)
+	}
+	if s.Tier() != TierHigh {
+		t.Errorf("Expected tier %s, got %s", TierHigh, s.Tier())
+	}
+
+	_, err = CompareSimilarity("", h4)
+	assertError(t, err)
+}
+
+func TestSimilarityTier(t *testing.T) {
+	for s, tier := range map[Similarity]string{
+		0:   TierNone,
+		1:   TierLow,
+		49:  TierLow,
+		50:  TierMedium,
+		80:  TierHigh,
+		100: TierIdentical,
+	} {
+		if s.Tier() != tier {
+			t.Errorf("%d: expected tier %s, got %s", s, tier, s.Tier())
+		}
+	}
+	if Similarity(0).IsMatch(0) {
+		t.Error("A zero score should never match")
+	}
+}
+
+func TestIncompatibility(t *testing.T) {
+	for _, tc := range []struct {
+		hash1, hash2, reason string
+	}{
+		{h3, h4, ""},
+		{h1, h1, ""},
+		{"6:abcdefgh:ijklmnop", "48:abcdefgh:ijklmnop", "block sizes 6 and 48 differ by more than 2x"},
+		{"6:abcdefgh:ijklmnop", "6:qrstuvwx:yz012345", "no common 7-char substring"},
+		{"6:abcdefgh:ijklmnop", "12:ijklmnop:qrstuvwx", ""},
+		{"12:ijklmnop:qrstuvwx", "6:abcdefgh:ijklmnop", ""},
+		{"6:abc:def", "6:abc:def", ""},
+		{"6:abc:def", "6:abc:xyz", "no common 7-char substring"},
+	} {
+		reason, err := Incompatibility(tc.hash1, tc.hash2)
+		assertNoError(t, err)
+		if reason != tc.reason {
+			t.Errorf("%s vs %s: %q (expected) != %q (actual)", tc.hash1, tc.hash2, tc.reason, reason)
+		}
+		d, err := Compare(tc.hash1, tc.hash2)
+		assertNoError(t, err)
+		if (reason == "") != (d > 0) {
+			t.Errorf("%s vs %s: reason %q disagrees with score %d", tc.hash1, tc.hash2, reason, d)
+		}
+	}
+
+	_, err := Incompatibility("5:abc:def", h1)
+	assertError(t, err)
+}
+
+func TestCompareUntrusted(t *testing.T) {
+	d, err := CompareUntrusted(h3, h4)
+	assertNoError(t, err)
+	assertDistanceEqual(t, 97, d)
+
+	for _, tc := range []struct {
+		hash string
+		err  error
+	}{
+		{"3:abc:d!f", ErrInvalidCharacter},
+		{"3:" + strings.Repeat("a", spamSumLength+1) + ":a", ErrSignatureTooLong},
+		{"3:a:" + strings.Repeat("a", spamSumLength/2+1), ErrSignatureTooLong},
+		{strings.Repeat("3", 10000) + ":a:a", ErrSignatureTooLong},
+		{"5:abc:def", ErrInvalidBlockSize},
+		{"3:abc", ErrInvalidFormat},
+	} {
+		_, err := CompareUntrusted(tc.hash, h3)
+		if err != tc.err {
+			t.Errorf("%.40q: expected %v, got %v", tc.hash, tc.err, err)
+		}
+		_, err = CompareUntrusted(h3, tc.hash)
+		if err != tc.err {
+			t.Errorf("%.40q: expected %v, got %v", tc.hash, tc.err, err)
+		}
+	}
+}
+
+func TestCompareEmptySignatures(t *testing.T) {
+	d, err := CompareUntrusted("3::", "3::")
+	assertNoError(t, err)
+	assertDistanceEqual(t, 100, d)
+	d, err = CompareUntrusted("3:a:", "3:b:")
+	assertNoError(t, err)
+	assertDistanceEqual(t, 0, d)
+}
+
+// TestUnrelatedInputsScoreLow establishes the expected scores of unrelated inputs of
+// the same size: their signatures almost never share a 7-character substring, so the
+// prefilter rejects nearly every pair and any remaining score stays low.
+func TestUnrelatedInputsScoreLow(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	hashes := make([]string, 30)
+	for i := range hashes {
+		blob := make([]byte, 64*1024)
+		r.Read(blob)
+		var err error
+		hashes[i], err = FuzzyBytes(blob)
+		assertNoError(t, err)
+	}
+
+	pairs, prefiltered := 0, 0
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			pairs++
+			d, err := Compare(hashes[i], hashes[j])
+			assertNoError(t, err)
+			if d > 20 {
+				t.Errorf("Unrelated inputs scored %d: %s vs %s", d, hashes[i], hashes[j])
+			}
+			reason, err := Incompatibility(hashes[i], hashes[j])
+			assertNoError(t, err)
+			if reason != "" {
+				prefiltered++
+			}
+		}
+	}
+	if prefiltered*100 < pairs*95 {
+		t.Errorf("Only %d of %d unrelated pairs were rejected by the prefilter", prefiltered, pairs)
+	}
+}
+
+func TestLongestCommonSignature(t *testing.T) {
+	for _, tc := range []struct {
+		hash1, hash2, expected string
+	}{
+		{h1, h2, "6+wNQ7Q40L/i"},
+		{"6:abcdefgh:ijklmnop", "12:xxklmnopyy:zz", "klmnop"},
+		{"6:abcdefgh:ijklmnop", "48:abcdefgh:ijklmnop", ""},
+		{"6:abcdefgh:ijkl", "6:zzzdefzzz:ijklmn", "ijkl"},
+		{"6:xAAAAAAAAy:", "6:zAAAAAz:", "AAA"},
+	} {
+		s, err := LongestCommonSignature(tc.hash1, tc.hash2)
+		assertNoError(t, err)
+		assertHashEqual(t, tc.expected, s)
+	}
+	_, err := LongestCommonSignature(h1, "3:abc")
+	assertError(t, err)
+}
+
+func TestCompareEliminatesSequences(t *testing.T) {
+	d, err := Compare("3:abcdefgAAAAAAAAAAhijklmn:", "3:abcdefgAAAhijklmn:")
+	assertNoError(t, err)
+	assertDistanceEqual(t, 100, d)
+}
+
+func TestCompareWithOptionsMinCommonSubstring(t *testing.T) {
+	// The signatures share "abcdef", 6 characters.
+	hash1 := "3:abcdefXXXXXXXXXXXXXX:"
+	hash2 := "3:abcdefYYYYYYYYYYYYYY:"
+
+	d, err := CompareWithOptions(hash1, hash2, CompareOptions{})
+	assertNoError(t, err)
+	assertDistanceEqual(t, 0, d)
+	d2, err := Compare(hash1, hash2)
+	assertNoError(t, err)
+	assertDistanceEqual(t, d, d2)
+
+	d, err = CompareWithOptions(hash1, hash2, CompareOptions{MinCommonSubstring: 6})
+	assertNoError(t, err)
+	if d == 0 {
+		t.Fatal("A 6-character common substring should be enough")
+	}
+
+	d, err = CompareWithOptions(h3, h4, CompareOptions{MinCommonSubstring: 63})
+	assertNoError(t, err)
+	assertDistanceEqual(t, 0, d)
+
+	_, err = CompareWithOptions("", h4, CompareOptions{})
+	assertError(t, err)
+}
+
+func TestCompareEqualBlockSizeUsesBothSignatures(t *testing.T) {
+	// The first signatures share nothing, the second ones are nearly identical.
+	hash1 := "48:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA:5DHoJXv7XOq7Mb2TwYHXREN/3QrmktPd"
+	hash2 := "48:zyxwvutsrqponmlkjihgfedcba9876543210+/ZY:5DHoJXv7XOq7Mb2TwYHXREN/3QrmktPt"
+	d, err := Compare(hash1, hash2)
+	assertNoError(t, err)
+	if d < 90 {
+		t.Fatalf("Expected a high score from the second signatures, got %d", d)
+	}
+	d2, err := Distance(hash1, hash2)
+	assertNoError(t, err)
+	assertDistanceEqual(t, d, d2)
+}
+
+func TestCompareDistance(t *testing.T) {
+	for _, tc := range []struct {
+		hash1, hash2 string
+		expected     float64
+	}{
+		{h1, h1, 0},
+		{h3, h4, 0.03},
+		{h1, h3, 1},
+	} {
+		d, err := CompareDistance(tc.hash1, tc.hash2)
+		assertNoError(t, err)
+		if math.Abs(d-tc.expected) > 1e-9 {
+			t.Errorf("Distance mismatch: %f (expected) != %f (actual)", tc.expected, d)
+		}
+	}
+	d, err := CompareDistance("", h1)
+	assertError(t, err)
+	if d != 1 {
+		t.Errorf("Expected distance 1 on error, got %f", d)
+	}
+}
+
+func TestCompareMatchesReference(t *testing.T) {
+	for _, tc := range []struct {
+		hash1, hash2 string
+		expected     int
+	}{
+		// Example from the python-ssdeep documentation.
+		{"3:AXGBicFlgVNhBGcL6wCrFQEv:AXGHsNhxLsr2C", "3:AXGBicFlIHBGcL6wCrFQEv:AXGH6xLsr2Cx", 22},
+		// Small block sizes cap the score at blockSize/blockMin times the shortest length.
+		{"3:abcdefgh:", "3:abcdefgi:", 8},
+		{"6:abcdefgh:", "6:abcdefgi:", 16},
+		{"48:abcdefgh:", "48:abcdefgi:", 88},
+		// Identical first signatures are not enough when the block size is small.
+		{"3:abcdefgh:x", "3:abcdefgh:y", 8},
+		// Signatures shorter than 7 characters cannot have a common substring.
+		{"96:abcdef:abc", "96:abcdeg:abc", 0},
+		// Adjacent block sizes compare the signatures computed at the common block size.
+		{"96:zzzzzzz:abcdefghijklmnop", "192:abcdefghijklmnoq:yyyyyyy", 94},
+		{"192:abcdefghijklmnoq:yyyyyyy", "96:zzzzzzz:abcdefghijklmnop", 94},
+		{"96:abcdefghijklmnop:zzzzzzz", "384:abcdefghijklmnop:yyyyyyy", 0},
+	} {
+		d, err := Compare(tc.hash1, tc.hash2)
+		assertNoError(t, err)
+		if d != tc.expected {
+			t.Errorf("%s vs %s: %d (expected) != %d (actual)", tc.hash1, tc.hash2, tc.expected, d)
+		}
+		d, err = Distance(tc.hash1, tc.hash2)
+		assertNoError(t, err)
+		if d != tc.expected {
+			t.Errorf("Distance %s vs %s: %d (expected) != %d (actual)", tc.hash1, tc.hash2, tc.expected, d)
+		}
+		a, err := ParseHash(tc.hash1)
+		assertNoError(t, err)
+		b, err := ParseHash(tc.hash2)
+		assertNoError(t, err)
+		if d := HashDistance(a, b); d != tc.expected {
+			t.Errorf("HashDistance %s vs %s: %d (expected) != %d (actual)", tc.hash1, tc.hash2, tc.expected, d)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package ssdeep
+
+import "errors"
+
+// SelfSimilarity splits buf into consecutive windows of windowSize bytes, hashes
+// each of them and returns the match score of every window with the next one.
+// All windows are hashed at the block size ssdeep would pick for a single window,
+// so the scores are comparable along the sequence. A trailing window shorter
+// than windowSize is ignored.
+// High scores reveal repeated content inside the buffer.
+// Returns an error when buf does not hold at least two windows.
+func SelfSimilarity(buf []byte, windowSize int64) ([]int, error) {
+	if windowSize <= 0 {
+		return nil, errors.New("window size must be positive")
+	}
+	count := int64(len(buf)) / windowSize
+	if count < 2 {
+		return nil, ErrSmallInput
+	}
+
+	state := newSsdeepState()
+	state.getBlockSize(windowSize)
+
+	hashes := make([]Hash, count)
+	for i := range hashes {
+		start := int64(i) * windowSize
+		h, err := FuzzyBytesAtBlockSize(buf[start:start+windowSize], state.blockSize)
+		if err != nil {
+			return nil, err
+		}
+		if hashes[i], err = ParseHash(h); err != nil {
+			return nil, err
+		}
+	}
+
+	scores := make([]int, count-1)
+	for i := range scores {
+		scores[i] = compare(hashes[i], hashes[i+1])
+	}
+	return scores, nil
+}
@@ -0,0 +1,53 @@
+package ssdeep
+
+// Similarity is the match score of two signatures, from zero (no match) to 100 (identical).
+type Similarity int
+
+// Tiers returned by Similarity.Tier.
+const (
+	TierNone      = "none"
+	TierLow       = "low"
+	TierMedium    = "medium"
+	TierHigh      = "high"
+	TierIdentical = "identical"
+)
+
+// CompareSimilarity computes the match score between two fuzzy hash signatures
+// as a Similarity. See Compare for the validation applied to the signatures.
+func CompareSimilarity(hash1, hash2 string) (Similarity, error) {
+	score, err := Compare(hash1, hash2)
+	return Similarity(score), err
+}
+
+// IsMatch reports whether the score reaches threshold.
+// A zero score never matches, whatever the threshold.
+func (s Similarity) IsMatch(threshold int) bool {
+	return s > 0 && int(s) >= threshold
+}
+
+// Percent returns the score as a percentage, clamped to [0, 100].
+func (s Similarity) Percent() int {
+	switch {
+	case s < 0:
+		return 0
+	case s > 100:
+		return 100
+	}
+	return int(s)
+}
+
+// Tier buckets the score into a coarse, human readable level: none for a zero score,
+// low below 50, medium below 80, high below 100 and identical for 100.
+func (s Similarity) Tier() string {
+	switch p := s.Percent(); {
+	case p == 0:
+		return TierNone
+	case p < 50:
+		return TierLow
+	case p < 80:
+		return TierMedium
+	case p < 100:
+		return TierHigh
+	}
+	return TierIdentical
+}
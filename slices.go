@@ -0,0 +1,71 @@
+package ssdeep
+
+import (
+	"errors"
+	"io"
+)
+
+// FuzzyByteSlices computes the fuzzy hash of the concatenation of several slices of byte,
+// without allocating a combined buffer.
+// It is the caller's responsibility to append the filename, if any, to result after computation.
+// Returns an error when ssdeep could not be computed on the buffers.
+func FuzzyByteSlices(buffers ...[]byte) (string, error) {
+	r := &slicesReader{buffers: buffers}
+	for _, b := range buffers {
+		r.size += int64(len(b))
+	}
+	return FuzzyReader(r, r.size)
+}
+
+// slicesReader reads a list of slices of byte as one logical input.
+type slicesReader struct {
+	buffers [][]byte
+	size    int64
+	off     int64
+	// i and pos locate off: the next byte read is buffers[i][pos].
+	i   int
+	pos int
+}
+
+func (r *slicesReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && r.i < len(r.buffers) {
+		c := copy(p[n:], r.buffers[r.i][r.pos:])
+		n += c
+		r.pos += c
+		if r.pos == len(r.buffers[r.i]) {
+			r.i++
+			r.pos = 0
+		}
+	}
+	r.off += int64(n)
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (r *slicesReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return r.off, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return r.off, errors.New("negative position")
+	}
+	r.off = offset
+	r.i, r.pos = 0, 0
+	for r.i < len(r.buffers) && offset >= int64(len(r.buffers[r.i])) {
+		offset -= int64(len(r.buffers[r.i]))
+		r.i++
+	}
+	if r.i < len(r.buffers) {
+		r.pos = int(offset)
+	}
+	return r.off, nil
+}
@@ -1,12 +1,11 @@
 package ssdeep
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
-	"fmt"
 	"io"
 	"os"
+	"strconv"
 )
 
 const (
@@ -24,7 +23,7 @@ var ErrSmallInput = errors.New("Too small data size")
 var ErrSmallBlock = errors.New("Too small block size")
 
 type rollingState struct {
-	window []byte
+	window [rollingWindow]byte
 	h1     uint32
 	h2     uint32
 	h3     uint32
@@ -35,28 +34,54 @@ func (rs rollingState) rollSum() uint32 {
 	return rs.h1 + rs.h2 + rs.h3
 }
 
+// blockState holds the signatures being computed at one block size.
+// The hash strings are bounded by spamSumLength and spamSumLength/2 characters, so they
+// are stored in arrays rather than allocated. Once a hash string is full, the slot past
+// its end holds the character of the block ending at the last boundary, as in libfuzzy,
+// which ends the signature with it when the rolling hash is zero at the end of the input.
+type blockState struct {
+	blockHash1  uint32
+	blockHash2  uint32
+	hashString1 [spamSumLength]byte
+	hashString2 [spamSumLength / 2]byte
+	len1        int
+	len2        int
+	// boundaries counts the block boundaries hit.
+	boundaries int
+}
+
+func newBlockState() blockState {
+	return blockState{blockHash1: hashInit, blockHash2: hashInit}
+}
+
+// boundary appends the characters of the blocks ending at a boundary of blockSize, rh
+// being the value of the rolling hash there.
+func (b *blockState) boundary(rh, blockSize int64) {
+	b.boundaries++
+	b.hashString1[b.len1] = b64[b.blockHash1%64]
+	if b.len1 < spamSumLength-1 {
+		b.len1++
+		b.blockHash1 = hashInit
+	}
+	if rh%(blockSize*2) == blockSize*2-1 {
+		b.hashString2[b.len2] = b64[b.blockHash2%64]
+		if b.len2 < spamSumLength/2-1 {
+			b.len2++
+			b.blockHash2 = hashInit
+		}
+	}
+}
+
 type ssdeepState struct {
 	rollingState rollingState
 	blockSize    int64
-	hashString1  string
-	hashString2  string
-	blockHash1   uint32
-	blockHash2   uint32
+	blockState
+	// eliminateSequences makes finalize collapse runs of identical characters.
+	eliminateSequences bool
 }
 
 func newSsdeepState() ssdeepState {
-	return ssdeepState{
-		blockHash1: hashInit,
-		blockHash2: hashInit,
-		rollingState: rollingState{
-			window: make([]byte, rollingWindow),
-		},
-	}
-}
-
-func (state *ssdeepState) newRollingState() {
-	state.rollingState = rollingState{}
-	state.rollingState.window = make([]byte, rollingWindow)
+	return ssdeepState{blockState: newBlockState()}
 }
 
 // sumHash based on FNV hash
@@ -66,7 +91,10 @@ func sumHash(c byte, h uint32) uint32 {
 
 // rollHash based on Adler checksum
 func (state *ssdeepState) rollHash(c byte) {
-	rs := &state.rollingState
+	state.rollingState.roll(c)
+}
+
+func (rs *rollingState) roll(c byte) {
 	rs.h2 -= rs.h1
 	rs.h2 += rollingWindow * uint32(c)
 	rs.h1 += uint32(c)
@@ -80,7 +108,30 @@ func (state *ssdeepState) rollHash(c byte) {
 	rs.h3 ^= uint32(c)
 }
 
-// getBlockSize calculates the block size based on file size
+// RollingSumAt returns the value of the rolling hash once the byte at position pos of buf
+// has been processed, as used to decide where block boundaries fall: a boundary is placed
+// after pos when the value modulo the block size is the block size minus one.
+// The rolling hash only depends on the last rollingWindow bytes, so the value is recomputed
+// from the start of that window rather than from the start of buf.
+// Returns zero when pos is out of range.
+func RollingSumAt(buf []byte, pos int) uint32 {
+	if pos < 0 || pos >= len(buf) {
+		return 0
+	}
+	start := pos - int(rollingWindow) + 1
+	if start < 0 {
+		start = 0
+	}
+	state := newSsdeepState()
+	for _, b := range buf[start : pos+1] {
+		state.rollHash(b)
+	}
+	return state.rollingState.rollSum()
+}
+
+// getBlockSize calculates the block size based on file size.
+// Like libfuzzy, the block size only doubles while blockSize*spamSumLength is strictly
+// below n, so an input of exactly blockSize*spamSumLength bytes keeps blockSize.
 func (state *ssdeepState) getBlockSize(n int64) {
 	blockSize := blockMin
 	for blockSize*spamSumLength < n {
@@ -95,16 +146,7 @@ func (state *ssdeepState) processByte(b byte) {
 	state.rollHash(b)
 	rh := int64(state.rollingState.rollSum())
 	if rh%state.blockSize == (state.blockSize - 1) {
-		if len(state.hashString1) < spamSumLength-1 {
-			state.hashString1 += string(b64[state.blockHash1%64])
-			state.blockHash1 = hashInit
-		}
-		if rh%(state.blockSize*2) == ((state.blockSize * 2) - 1) {
-			if len(state.hashString2) < spamSumLength/2-1 {
-				state.hashString2 += string(b64[state.blockHash2%64])
-				state.blockHash2 = hashInit
-			}
-		}
+		state.boundary(rh, state.blockSize)
 	}
 }
 
@@ -115,48 +157,132 @@ type Reader interface {
 	io.Reader
 }
 
-func (state *ssdeepState) process(r *bufio.Reader) {
-	state.newRollingState()
-	b, err := r.ReadByte()
-	for err == nil {
-		state.processByte(b)
-		b, err = r.ReadByte()
-	}
+// DetailedResult is a fuzzy hash along with statistics about its computation.
+type DetailedResult struct {
+	// Hash is the fuzzy hash, as returned by FuzzyReader.
+	Hash string
+	// BlockSize is the block size the hash was computed at.
+	BlockSize int64
+	// Size is the size of the input in bytes.
+	Size int64
+	// BoundaryHits is the number of block boundaries hit at BlockSize.
+	// It drives the length of the first signature, which is capped at spamSumLength
+	// characters, and thus tells how much resolution the hash has.
+	BoundaryHits int
 }
 
 // FuzzyReader computes the fuzzy hash of a Reader interface with a given input size.
 // It is the caller's responsibility to append the filename, if any, to result after computation.
 // Returns an error when ssdeep could not be computed on the Reader.
 func FuzzyReader(f Reader, size int64) (string, error) {
-	if size < minFileSize {
-		return "", ErrSmallInput
+	return FuzzyReaderOptions(f, size, Options{})
+}
+
+// Options configures FuzzyReaderOptions. The zero value gives the behavior of FuzzyReader.
+type Options struct {
+	// AllowSmall lifts the minimum input size of minFileSize bytes, so that small files
+	// such as configuration files or test fixtures can be hashed. The block size is then
+	// never halved below blockMin: when even blockMin gives a short signature, the hash
+	// is computed at blockMin rather than failing with ErrSmallBlock, as ssdeep does.
+	// Hashes of small inputs have short signatures and compare less reliably.
+	AllowSmall bool
+	// EliminateSequences collapses every run of more than three identical characters in
+	// the signatures to three, as libfuzzy does with FUZZY_FLAG_ELIMSEQ, so that hashes
+	// are identical to the ones of tools using that mode. As in libfuzzy, runs are
+	// collapsed once the signatures are complete: the length limits and the choice of
+	// the block size still apply to the signatures before collapsing.
+	// Comparison scores are unchanged, since Compare collapses runs anyway.
+	EliminateSequences bool
+}
+
+// FuzzyReaderOptions computes the fuzzy hash of a Reader interface with a given input size,
+// like FuzzyReader, with the behavior adjusted by opts.
+// Returns an error when ssdeep could not be computed on the Reader.
+func FuzzyReaderOptions(f Reader, size int64, opts Options) (string, error) {
+	result, err := fuzzyReaderDetailed(f, size, opts)
+	if err != nil {
+		return "", err
 	}
-	state := newSsdeepState()
-	state.getBlockSize(size)
-	for {
-		f.Seek(0, 0)
-		r := bufio.NewReader(f)
-		state.process(r)
-		if state.blockSize < blockMin {
-			return "", ErrSmallBlock
+	return result.Hash, nil
+}
+
+func fuzzyReaderDetailed(f Reader, size int64, opts Options) (DetailedResult, error) {
+	if size < minFileSize && !opts.AllowSmall {
+		return DetailedResult{}, ErrSmallInput
+	}
+	f.Seek(0, io.SeekStart)
+	// The size is known, so the digest only tracks the block sizes FuzzyReader may settle
+	// on, and the input is read once whatever the number of times the block size is halved.
+	d := newSizedDigest(size)
+	if _, err := io.Copy(d, f); err != nil {
+		return DetailedResult{}, err
+	}
+	state, err := d.state(opts)
+	if err != nil {
+		return DetailedResult{}, err
+	}
+	return DetailedResult{
+		BlockSize:    state.blockSize,
+		Size:         size,
+		BoundaryHits: state.boundaries,
+		Hash:         state.finalize(),
+	}, nil
+}
+
+// finalize formats the signature, appending the remaining data to the hash strings.
+func (state *ssdeepState) finalize() string {
+	buf := make([]byte, 0, 24+spamSumLength+spamSumLength/2)
+	buf = strconv.AppendInt(buf, state.blockSize, 10)
+	rh := state.rollingState.rollSum()
+	for _, part := range []struct {
+		hashString []byte
+		blockHash  uint32
+		last       byte
+	}{
+		{state.hashString1[:state.len1], state.blockHash1, state.hashString1[state.len1]},
+		{state.hashString2[:state.len2], state.blockHash2, state.hashString2[state.len2]},
+	} {
+		buf = append(buf, ':')
+		start := len(buf)
+		for _, c := range part.hashString {
+			buf = state.appendHashChar(buf, start, c)
 		}
-		if len(state.hashString1) < spamSumLength/2 {
-			state.blockSize = state.blockSize / 2
-			state.blockHash1 = hashInit
-			state.blockHash2 = hashInit
-			state.hashString1 = ""
-			state.hashString2 = ""
-		} else {
-			rh := state.rollingState.rollSum()
-			if rh != 0 {
-				// Finalize the hash string with the remaining data
-				state.hashString1 += string(b64[state.blockHash1%64])
-				state.hashString2 += string(b64[state.blockHash2%64])
-			}
-			break
+		if rh != 0 {
+			// Finalize the hash string with the remaining data
+			buf = state.appendHashChar(buf, start, b64[part.blockHash%64])
+		} else if part.last != 0 {
+			// Like libfuzzy, a full hash string ends with the character of the block
+			// ending at its last boundary.
+			buf = state.appendHashChar(buf, start, part.last)
 		}
 	}
-	return fmt.Sprintf("%d:%s:%s", state.blockSize, state.hashString1, state.hashString2), nil
+	return string(buf)
+}
+
+// appendHashChar appends c to the hash string starting at buf[start], unless sequences
+// are eliminated and c would be the fourth identical character in a row.
+func (state *ssdeepState) appendHashChar(buf []byte, start int, c byte) []byte {
+	if n := len(buf); state.eliminateSequences && n-start >= 3 &&
+		buf[n-1] == c && buf[n-2] == c && buf[n-3] == c {
+		return buf
+	}
+	return append(buf, c)
+}
+
+// FuzzyBytesAtBlockSize computes the fuzzy hash of a slice of byte using a fixed block size
+// instead of deriving it from the size of the buffer.
+// Hashes computed at the same block size are always comparable, whatever the size of their input.
+// Returns an error when blockSize is not a block size ssdeep could have chosen.
+func FuzzyBytesAtBlockSize(buffer []byte, blockSize int64) (string, error) {
+	if !validBlockSize(blockSize) {
+		return "", ErrInvalidBlockSize
+	}
+	state := newSsdeepState()
+	state.blockSize = blockSize
+	for _, b := range buffer {
+		state.processByte(b)
+	}
+	return state.finalize(), nil
 }
 
 // FuzzyFilename computes the fuzzy hash of a file.
@@ -180,20 +306,31 @@ func FuzzyFilename(filename string) (string, error) {
 // It is the callers's responsibility to append the filename to the result after computation.
 // Returns an error when ssdeep could not be computed on the file.
 func FuzzyFile(f *os.File) (string, error) {
-	currentPosition, err := f.Seek(0, io.SeekCurrent)
+	result, err := FuzzyFileDetailed(f)
 	if err != nil {
 		return "", err
 	}
+	return result.Hash, nil
+}
+
+// FuzzyFileDetailed computes the fuzzy hash of a file like FuzzyFile, and also returns
+// statistics about the computation.
+// Returns an error when ssdeep could not be computed on the file.
+func FuzzyFileDetailed(f *os.File) (DetailedResult, error) {
+	currentPosition, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return DetailedResult{}, err
+	}
 
 	f.Seek(0, io.SeekStart)
 	stat, err := f.Stat()
 	if err != nil {
-		return "", err
+		return DetailedResult{}, err
 	}
 
-	result, err := FuzzyReader(f, stat.Size())
+	result, err := fuzzyReaderDetailed(f, stat.Size(), Options{})
 	if err != nil {
-		return "", err
+		return DetailedResult{}, err
 	}
 
 	f.Seek(currentPosition, io.SeekStart)
@@ -214,3 +351,43 @@ func FuzzyBytes(buffer []byte) (string, error) {
 
 	return result, nil
 }
+
+// FuzzyBytesOptions computes the fuzzy hash of a slice of byte like FuzzyBytes, with the
+// behavior adjusted by opts. With opts.AllowSmall, buffers of any size are hashed like
+// fuzzy_hash_buf in libfuzzy does, rather than failing with ErrSmallInput.
+// Returns an error when ssdeep could not be computed on the buffer.
+func FuzzyBytesOptions(buffer []byte, opts Options) (string, error) {
+	return FuzzyReaderOptions(bytes.NewReader(buffer), int64(len(buffer)), opts)
+}
+
+// FuzzyBytesNormalized computes the fuzzy hash of a slice of byte and returns it both as
+// computed and with its sequences eliminated (see Hash.EliminateSequences).
+// Services matching many hashes can store the normalized form to compare against,
+// and keep the raw form for display and exchange with other tools.
+// Returns an error when ssdeep could not be computed on the buffer.
+func FuzzyBytesNormalized(buffer []byte) (raw Hash, normalized Hash, err error) {
+	result, err := FuzzyBytes(buffer)
+	if err != nil {
+		return Hash{}, Hash{}, err
+	}
+	raw, err = ParseHash(result)
+	if err != nil {
+		return Hash{}, Hash{}, err
+	}
+	return raw, raw.EliminateSequences(), nil
+}
+
+// FuzzyBytesMaxResolution computes the fuzzy hash of a slice of byte at the smallest block
+// size, whatever the size of the buffer, producing the most detailed signatures.
+// Such hashes are only comparable to other hashes computed at the same forced block size:
+// they should not be mixed with hashes from FuzzyBytes. Since a signature holds at most
+// spamSumLength characters, the last character of the first signature covers everything
+// past roughly the first spamSumLength*blockMin bytes on average, so this suits many
+// small, similar inputs rather than large ones.
+func FuzzyBytesMaxResolution(buffer []byte) (Hash, error) {
+	result, err := FuzzyBytesAtBlockSize(buffer, blockMin)
+	if err != nil {
+		return Hash{}, err
+	}
+	return ParseHash(result)
+}
@@ -1,11 +1,14 @@
 package ssdeep
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -67,11 +70,7 @@ func concatCopyPreAllocate(slices [][]byte) []byte {
 }
 
 func TestRollingHash(t *testing.T) {
-	s := ssdeepState{
-		rollingState: rollingState{
-			window: make([]byte, rollingWindow),
-		},
-	}
+	s := ssdeepState{}
 	s.rollHash(byte('A'))
 	rh := s.rollingState.rollSum()
 	if rh != 585 {
@@ -137,6 +136,39 @@ func TestFuzzyBytesWithOutputsAnError(t *testing.T) {
 	assertError(t, err)
 }
 
+func TestFuzzyReaderOptionsAllowSmall(t *testing.T) {
+	for input, expected := range map[string]string{
+		"":           "3::",
+		"0123456789": "3:oWS:oWS",
+		"hello world, this is a short config file\n": "3:iKFSMPFVEN5Nn:rJPFuN5N",
+	} {
+		for i := 0; i < 2; i++ {
+			result, err := FuzzyReaderOptions(strings.NewReader(input), int64(len(input)), Options{AllowSmall: true})
+			assertNoError(t, err)
+			assertHashEqual(t, expected, result)
+		}
+	}
+
+	// Inputs FuzzyReader accepts hash the same, unless it would fail with ErrSmallBlock.
+	blob := make([]byte, 10000)
+	rand.Read(blob)
+	expected, err := FuzzyBytes(blob)
+	assertNoError(t, err)
+	result, err := FuzzyReaderOptions(bytes.NewReader(blob), int64(len(blob)), Options{AllowSmall: true})
+	assertNoError(t, err)
+	assertHashEqual(t, expected, result)
+
+	zeros := make([]byte, 4096)
+	result, err = FuzzyReaderOptions(bytes.NewReader(zeros), int64(len(zeros)), Options{AllowSmall: true})
+	assertNoError(t, err)
+	assertHashEqual(t, "3::", result)
+
+	_, err = FuzzyReaderOptions(strings.NewReader("0123456789"), 10, Options{})
+	if err != ErrSmallInput {
+		t.Errorf("Expected ErrSmallInput without AllowSmall, got %v", err)
+	}
+}
+
 func BenchmarkRollingHash(b *testing.B) {
 	s := newSsdeepState()
 	for i := 0; i < b.N; i++ {
@@ -162,8 +194,461 @@ func BenchmarkBlockSize(b *testing.B) {
 func BenchmarkProcessByte(b *testing.B) {
 	s := newSsdeepState()
 	s.blockSize = 42
-	s.newRollingState()
 	for i := 0; i < b.N; i++ {
 		s.processByte(byte(i))
 	}
 }
+
+func TestFuzzyBytesAtBlockSize(t *testing.T) {
+	b, err := ioutil.ReadFile("LICENSE")
+	assertNoError(t, err)
+	b = concatCopyPreAllocate([][]byte{b, b})
+
+	hashResult, err := FuzzyBytesAtBlockSize(b, 96)
+	assertNoError(t, err)
+	expectedResult, err := FuzzyBytes(b)
+	assertNoError(t, err)
+	assertHashEqual(t, expectedResult, hashResult)
+
+	hashResult, err = FuzzyBytesAtBlockSize(b[:100], 3)
+	assertNoError(t, err)
+	h, err := ParseHash(hashResult)
+	assertNoError(t, err)
+	if h.BlockSize != 3 {
+		t.Fatalf("Expected block size 3, got %s", hashResult)
+	}
+
+	_, err = FuzzyBytesAtBlockSize(b, 5)
+	assertError(t, err)
+}
+
+func TestSelfSimilarity(t *testing.T) {
+	rand.Seed(1)
+	window := make([]byte, 8192)
+	other := make([]byte, 8192)
+	rand.Read(window)
+	rand.Read(other)
+	buf := concatCopyPreAllocate([][]byte{window, window, other})
+
+	scores, err := SelfSimilarity(buf, int64(len(window)))
+	assertNoError(t, err)
+	if len(scores) != 2 {
+		t.Fatalf("Expected 2 scores, got %v", scores)
+	}
+	if scores[0] != 100 {
+		t.Errorf("Repeated windows should score 100, got %d", scores[0])
+	}
+	if scores[1] > 50 {
+		t.Errorf("Unrelated windows should score low, got %d", scores[1])
+	}
+
+	_, err = SelfSimilarity(window, int64(len(window)))
+	assertError(t, err)
+}
+
+func TestFuzzyByteSlicesMatchesFuzzyBytes(t *testing.T) {
+	b, err := ioutil.ReadFile("ssdeep_results.json")
+	assertNoError(t, err)
+	expectedResult, err := FuzzyBytes(b)
+	assertNoError(t, err)
+
+	hashResult, err := FuzzyByteSlices(b[:10], nil, b[10:5000], []byte{}, b[5000:])
+	assertNoError(t, err)
+	assertHashEqual(t, expectedResult, hashResult)
+
+	hashResult, err = FuzzyByteSlices(b)
+	assertNoError(t, err)
+	assertHashEqual(t, expectedResult, hashResult)
+
+	_, err = FuzzyByteSlices(b[:100], b[100:200])
+	assertError(t, err)
+}
+
+func TestSlicesReaderSeek(t *testing.T) {
+	r := &slicesReader{buffers: [][]byte{[]byte("ab"), nil, []byte("cde")}, size: 5}
+	for _, tc := range []struct {
+		offset int64
+		whence int
+		rest   string
+	}{
+		{0, io.SeekStart, "abcde"},
+		{2, io.SeekStart, "cde"},
+		{-1, io.SeekEnd, "e"},
+		{5, io.SeekStart, ""},
+	} {
+		_, err := r.Seek(tc.offset, tc.whence)
+		assertNoError(t, err)
+		rest, err := ioutil.ReadAll(r)
+		assertNoError(t, err)
+		assertHashEqual(t, tc.rest, string(rest))
+	}
+}
+
+func TestGetBlockSizeAtDoublingThreshold(t *testing.T) {
+	for _, tc := range []struct {
+		n         int64
+		blockSize int64
+	}{
+		{0, 3},
+		{3 * 64, 3},
+		{3*64 + 1, 6},
+		{3 * 64 * 2, 6},
+		{3*64*2 + 1, 12},
+		{4096, 96},
+		{3 * 64 * 32, 96},
+		{3*64*32 + 1, 192},
+		{3 * 64 * 1024, 3072},
+		{3*64*1024 + 1, 6144},
+	} {
+		s := newSsdeepState()
+		s.getBlockSize(tc.n)
+		if s.blockSize != tc.blockSize {
+			t.Errorf("Block size for %d bytes: %d (expected) != %d (actual)", tc.n, tc.blockSize, s.blockSize)
+		}
+	}
+}
+
+func TestAllEntryPointsAgree(t *testing.T) {
+	blob := make([]byte, 1024*1024+17)
+	rand.Read(blob)
+	expected, err := FuzzyBytes(blob)
+	assertNoError(t, err)
+
+	f, err := ioutil.TempFile("", "ssdeep")
+	assertNoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = f.Write(blob)
+	assertNoError(t, err)
+
+	result, err := FuzzyFile(f)
+	assertNoError(t, err)
+	assertHashEqual(t, expected, result)
+
+	result, err = FuzzyFilename(f.Name())
+	assertNoError(t, err)
+	assertHashEqual(t, expected, result)
+
+	result, err = FuzzyReader(bytes.NewReader(blob), int64(len(blob)))
+	assertNoError(t, err)
+	assertHashEqual(t, expected, result)
+
+	result, err = FuzzyReaderAt(f, int64(len(blob)), WithPrefetch(1000, 2))
+	assertNoError(t, err)
+	assertHashEqual(t, expected, result)
+
+	result, err = FuzzyByteSlices(blob[:1], blob[1:4096], blob[4096:])
+	assertNoError(t, err)
+	assertHashEqual(t, expected, result)
+
+	for _, chunkSize := range []int{1, 13, 4096, len(blob)} {
+		d := New()
+		for i := 0; i < len(blob); i += chunkSize {
+			end := i + chunkSize
+			if end > len(blob) {
+				end = len(blob)
+			}
+			d.Write(blob[i:end])
+		}
+		result, err = d.Sum()
+		assertNoError(t, err)
+		assertHashEqual(t, expected, result)
+	}
+}
+
+// legacyFuzzyBytes is the original implementation building the signatures by string
+// concatenation, kept as a reference for the buffer-based one. It predates the handling
+// of full signatures when the rolling hash ends at zero, which the inputs of
+// TestFuzzyBytesMatchesLegacyImplementation never hit.
+func legacyFuzzyBytes(buf []byte) string {
+	blockSize := blockMin
+	for blockSize*spamSumLength < int64(len(buf)) {
+		blockSize *= 2
+	}
+	for {
+		var rs rollingState
+		h1, h2 := hashInit, hashInit
+		s1, s2 := "", ""
+		for _, c := range buf {
+			h1 = sumHash(c, h1)
+			h2 = sumHash(c, h2)
+			rs.roll(c)
+			rh := int64(rs.rollSum())
+			if rh%blockSize == blockSize-1 {
+				if len(s1) < spamSumLength-1 {
+					s1 += string(b64[h1%64])
+					h1 = hashInit
+				}
+				if rh%(blockSize*2) == blockSize*2-1 && len(s2) < spamSumLength/2-1 {
+					s2 += string(b64[h2%64])
+					h2 = hashInit
+				}
+			}
+		}
+		if len(s1) < spamSumLength/2 && blockSize/2 >= blockMin {
+			blockSize /= 2
+			continue
+		}
+		if rs.rollSum() != 0 {
+			s1 += string(b64[h1%64])
+			s2 += string(b64[h2%64])
+		}
+		return fmt.Sprintf("%d:%s:%s", blockSize, s1, s2)
+	}
+}
+
+func TestFuzzyBytesMatchesLegacyImplementation(t *testing.T) {
+	for _, size := range []int{4096, 4097, 10000, 65536, 300001, 3 * 1024 * 1024} {
+		random := make([]byte, size)
+		rand.Read(random)
+		// Low entropy data hits fewer boundaries and makes the block size halve several times.
+		repetitive := bytes.Repeat([]byte("ssdeep\x00\x00\x00\x00"), size/10+1)[:size]
+		for _, blob := range [][]byte{random, repetitive} {
+			result, err := FuzzyBytes(blob)
+			assertNoError(t, err)
+			assertHashEqual(t, legacyFuzzyBytes(blob), result)
+		}
+	}
+}
+
+func TestFuzzyBytesEndsFullSignaturesLikeLibfuzzy(t *testing.T) {
+	// Trailing zeros clear the rolling hash: libfuzzy then ends a full signature with the
+	// character of the block ending at its last boundary, which is the character the
+	// signature of the input cut right after that boundary ends with.
+	r := rand.New(rand.NewSource(1))
+	blob := make([]byte, 10000, 10016)
+	r.Read(blob)
+	blob = append(blob, make([]byte, 16)...)
+	if RollingSumAt(blob, len(blob)-1) != 0 {
+		t.Fatal("Trailing zeros should clear the rolling hash")
+	}
+	lastBoundary := func(blockSize int64) int {
+		for i := len(blob) - 1; i >= 0; i-- {
+			if int64(RollingSumAt(blob, i))%blockSize == blockSize-1 {
+				return i
+			}
+		}
+		return -1
+	}
+	cut1, err := FuzzyBytesAtBlockSize(blob[:lastBoundary(3)+1], 3)
+	assertNoError(t, err)
+	cut2, err := FuzzyBytesAtBlockSize(blob[:lastBoundary(6)+1], 3)
+	assertNoError(t, err)
+	h1, err := ParseHash(cut1)
+	assertNoError(t, err)
+	h2, err := ParseHash(cut2)
+	assertNoError(t, err)
+	if len(h1.Hash1) != spamSumLength || len(h2.Hash2) != spamSumLength/2 {
+		t.Fatalf("Signatures of %s and %s should be full", cut1, cut2)
+	}
+	expected := fmt.Sprintf("3:%s:%s", h1.Hash1, h2.Hash2)
+
+	result, err := FuzzyBytesAtBlockSize(blob, 3)
+	assertNoError(t, err)
+	assertHashEqual(t, expected, result)
+
+	// The last characters survive serialization.
+	d := New()
+	d.Write(blob)
+	data, err := d.MarshalBinary()
+	assertNoError(t, err)
+	var restored Digest
+	assertNoError(t, restored.UnmarshalBinary(data))
+	for i := d.start; i < d.end; i++ {
+		if restored.blocks[i] != d.blocks[i] {
+			t.Fatalf("Block size %d not restored: %+v != %+v", blockMin<<uint(i), restored.blocks[i], d.blocks[i])
+		}
+	}
+}
+
+// libfuzzyInput returns size bytes of the given kind followed by zeros zero bytes, the
+// input of a vector of testdata/libfuzzy/vectors.txt, like vectors.c builds it.
+func libfuzzyInput(kind string, size, zeros int) []byte {
+	blob := make([]byte, size+zeros)
+	x := uint32(1)
+	for i := 0; i < size; i++ {
+		if kind == "random" {
+			x = x*1103515245 + 12345
+			blob[i] = byte(x >> 16)
+		} else {
+			blob[i] = "\x01\x94\xfd"[i%3]
+		}
+	}
+	return blob
+}
+
+func TestLibfuzzyVectors(t *testing.T) {
+	// The vectors cover inputs ending with zeros, full signatures and
+	// FUZZY_FLAG_ELIMSEQ. They are written by testdata/libfuzzy/vectors.c, which has to
+	// be run against libfuzzy 2.14.1.
+	data, err := ioutil.ReadFile("testdata/libfuzzy/vectors.txt")
+	if os.IsNotExist(err) {
+		t.Skip("testdata/libfuzzy/vectors.txt is missing: generate it with testdata/libfuzzy/vectors.c")
+	}
+	assertNoError(t, err)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var kind, expected string
+		var size, zeros, elimseq int
+		if _, err := fmt.Sscan(line, &kind, &size, &zeros, &elimseq, &expected); err != nil {
+			t.Fatalf("Invalid vector %q: %v", line, err)
+		}
+		blob := libfuzzyInput(kind, size, zeros)
+		result, err := FuzzyBytesOptions(blob, Options{AllowSmall: true, EliminateSequences: elimseq == 1})
+		assertNoError(t, err)
+		if result != expected {
+			t.Errorf("%s %d %d %d: %s (expected) != %s (actual)", kind, size, zeros, elimseq, expected, result)
+		}
+	}
+}
+
+func TestFuzzyFileDetailed(t *testing.T) {
+	f, err := os.Open("ssdeep_results.json")
+	assertNoError(t, err)
+	defer f.Close()
+
+	result, err := FuzzyFileDetailed(f)
+	assertNoError(t, err)
+	assertHashEqual(t, "1536:74peLhFipssVfuInITTTZzMoW0379xy3u:VVFosEfudTj579k3u", result.Hash)
+	if result.BlockSize != 1536 {
+		t.Errorf("Expected block size 1536, got %d", result.BlockSize)
+	}
+	stat, err := f.Stat()
+	assertNoError(t, err)
+	if result.Size != stat.Size() {
+		t.Errorf("Expected size %d, got %d", stat.Size(), result.Size)
+	}
+	// The signature has one character per boundary hit, plus the final one.
+	if result.BoundaryHits != len("74peLhFipssVfuInITTTZzMoW0379xy3u")-1 {
+		t.Errorf("Unexpected boundary hits %d", result.BoundaryHits)
+	}
+}
+
+func TestFuzzyBytesNormalized(t *testing.T) {
+	// A short repeated pattern hashes to a long run of identical characters.
+	blob := bytes.Repeat([]byte{0x01, 0x94, 0xfd}, 2731)
+	raw, normalized, err := FuzzyBytesNormalized(blob)
+	assertNoError(t, err)
+	assertHashEqual(t, "12:E777O:1", normalized.String())
+
+	expected, err := FuzzyBytes(blob)
+	assertNoError(t, err)
+	assertHashEqual(t, expected, raw.String())
+	assertHashEqual(t, eliminateSequences(raw.Hash1), normalized.Hash1)
+	assertHashEqual(t, eliminateSequences(raw.Hash2), normalized.Hash2)
+	if normalized.BlockSize != raw.BlockSize {
+		t.Fatalf("Block size mismatch: %d != %d", raw.BlockSize, normalized.BlockSize)
+	}
+
+	d, err := Compare(raw.String(), normalized.String())
+	assertNoError(t, err)
+	assertDistanceEqual(t, 100, d)
+
+	_, _, err = FuzzyBytesNormalized(blob[:10])
+	assertError(t, err)
+}
+
+func TestFuzzyBytesOptionsSmallInputs(t *testing.T) {
+	// Example from the python-ssdeep documentation, computed by libfuzzy.
+	result, err := FuzzyBytesOptions([]byte("Also called fuzzy hashes, Ctph can match inputs that have homologies."), Options{AllowSmall: true})
+	assertNoError(t, err)
+	assertHashEqual(t, "3:AXGBicFlgVNhBGcL6wCrFQEv:AXGHsNhxLsr2C", result)
+	// libfuzzy hashes an empty input too.
+	result, err = FuzzyBytesOptions(nil, Options{AllowSmall: true})
+	assertNoError(t, err)
+	assertHashEqual(t, "3::", result)
+
+	for _, size := range []int{0, 1, 7, 100, 4095} {
+		blob := make([]byte, size)
+		rand.Read(blob)
+		_, err := FuzzyBytes(blob)
+		if err != ErrSmallInput {
+			t.Fatalf("Expected ErrSmallInput by default for %d bytes, got %v", size, err)
+		}
+		result, err := FuzzyBytesOptions(blob, Options{AllowSmall: true})
+		assertNoError(t, err)
+		_, err = ParseUntrusted(result)
+		assertNoError(t, err)
+	}
+}
+
+func TestFuzzyReaderOptionsEliminateSequences(t *testing.T) {
+	// A short repeated pattern hashes to a long run of identical characters.
+	blob := bytes.Repeat([]byte{0x01, 0x94, 0xfd}, 2731)
+	raw, err := FuzzyBytes(blob)
+	assertNoError(t, err)
+	result, err := FuzzyReaderOptions(bytes.NewReader(blob), int64(len(blob)), Options{})
+	assertNoError(t, err)
+	assertHashEqual(t, raw, result)
+
+	h, err := ParseHash(raw)
+	assertNoError(t, err)
+	if eliminateSequences(h.Hash1) == h.Hash1 {
+		t.Fatalf("%s has no run to collapse", raw)
+	}
+	result, err = FuzzyReaderOptions(bytes.NewReader(blob), int64(len(blob)), Options{EliminateSequences: true})
+	assertNoError(t, err)
+	assertHashEqual(t, h.EliminateSequences().String(), result)
+	assertHashEqual(t, "12:E777O:1", result)
+}
+
+func TestRollingSumAt(t *testing.T) {
+	blob := make([]byte, 1000)
+	rand.Read(blob)
+	s := newSsdeepState()
+	for i, b := range blob {
+		s.rollHash(b)
+		if rh := RollingSumAt(blob, i); rh != s.rollingState.rollSum() {
+			t.Fatalf("Rolling sum at %d: %d (expected) != %d (actual)", i, s.rollingState.rollSum(), rh)
+		}
+	}
+	if RollingSumAt([]byte("A"), 0) != 585 {
+		t.Fatal("Rolling hash not matching")
+	}
+	if RollingSumAt(blob, -1) != 0 || RollingSumAt(blob, len(blob)) != 0 {
+		t.Fatal("Out of range positions should give zero")
+	}
+}
+
+func TestFuzzyBytesMaxResolution(t *testing.T) {
+	b, err := ioutil.ReadFile("LICENSE")
+	assertNoError(t, err)
+	h, err := FuzzyBytesMaxResolution(b[:1000])
+	assertNoError(t, err)
+	if h.BlockSize != blockMin {
+		t.Fatalf("Expected block size %d, got %d", blockMin, h.BlockSize)
+	}
+	if len(h.Hash1) <= len(h.Hash2) {
+		t.Fatalf("Expected a detailed first signature, got %s", h)
+	}
+
+	// Small edits still leave comparable, similar hashes.
+	edited := concatCopyPreAllocate([][]byte{b[:100], []byte("edited"), b[106:1000]})
+	h2, err := FuzzyBytesMaxResolution(edited)
+	assertNoError(t, err)
+	d, err := Compare(h.String(), h2.String())
+	assertNoError(t, err)
+	if d < 50 {
+		t.Fatalf("Expected similar hashes, got %d for %s and %s", d, h, h2)
+	}
+}
+
+func BenchmarkFuzzyBytes(b *testing.B) {
+	blob := make([]byte, 4*1024*1024)
+	rand.Read(blob)
+	b.SetBytes(int64(len(blob)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		FuzzyBytes(blob)
+	}
+}
+
+func BenchmarkFuzzyBytesLowEntropy(b *testing.B) {
+	// Text-like data with few boundaries, making ssdeep halve the block size several
+	// times.
+	blob := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 4*1024*1024/44)
+	b.SetBytes(int64(len(blob)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		FuzzyBytes(blob)
+	}
+}
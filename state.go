@@ -0,0 +1,117 @@
+package ssdeep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrInvalidState is returned when a serialized hashing state cannot be decoded.
+var ErrInvalidState = errors.New("invalid hashing state")
+
+// digestMagic starts the encoding of a Digest and identifies its layout.
+const digestMagic = "ssd\x02"
+
+// MarshalBinary implements encoding.BinaryMarshaler. The encoding holds everything
+// needed to resume hashing: the rolling window, the signatures computed so far and the
+// hashes of the blocks in progress, so that a Digest can be restored in another process
+// with UnmarshalBinary and fed the rest of the data.
+func (d *Digest) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(digestMagic)
+	rs := d.rollingState
+	buf.Write(rs.window[:])
+	for _, v := range []uint32{rs.h1, rs.h2, rs.h3, rs.n} {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	for _, v := range []int64{d.size, d.sizeHint} {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	buf.Write([]byte{byte(d.start), byte(d.end), byte(d.limit)})
+	for _, b := range d.blocks[d.start:d.end] {
+		for _, v := range []uint32{b.blockHash1, b.blockHash2} {
+			binary.Write(&buf, binary.BigEndian, v)
+		}
+		binary.Write(&buf, binary.BigEndian, int64(b.boundaries))
+		writeHashStrings(&buf, &b)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, restoring a Digest encoded by
+// MarshalBinary.
+// Returns ErrInvalidState when data is not a valid encoding, leaving d unchanged.
+func (d *Digest) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(digestMagic)) {
+		return ErrInvalidState
+	}
+	r := bytes.NewReader(data[len(digestMagic):])
+	var n Digest
+	rs := &n.rollingState
+	if _, err := io.ReadFull(r, rs.window[:]); err != nil {
+		return ErrInvalidState
+	}
+	for _, v := range []interface{}{&rs.h1, &rs.h2, &rs.h3, &rs.n, &n.size, &n.sizeHint} {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return ErrInvalidState
+		}
+	}
+	var bounds [3]byte
+	if _, err := io.ReadFull(r, bounds[:]); err != nil {
+		return ErrInvalidState
+	}
+	n.start, n.end, n.limit = int(bounds[0]), int(bounds[1]), int(bounds[2])
+	if rs.n >= rollingWindow || n.size < 0 || n.sizeHint < 0 ||
+		n.start >= n.end || n.end > n.limit || n.limit > maxBlockSizes {
+		return ErrInvalidState
+	}
+	for i := n.start; i < n.end; i++ {
+		b := &n.blocks[i]
+		var boundaries int64
+		for _, v := range []interface{}{&b.blockHash1, &b.blockHash2, &boundaries} {
+			if err := binary.Read(r, binary.BigEndian, v); err != nil {
+				return ErrInvalidState
+			}
+		}
+		b.boundaries = int(boundaries)
+		if err := readHashStrings(r, b); err != nil {
+			return err
+		}
+	}
+	if r.Len() != 0 {
+		return ErrInvalidState
+	}
+	*d = n
+	return nil
+}
+
+// writeHashStrings writes the hash strings of b, each as its length followed by its
+// characters and the slot past its end, which holds the last character of a full one.
+func writeHashStrings(buf *bytes.Buffer, b *blockState) {
+	for _, s := range [][]byte{b.hashString1[:b.len1+1], b.hashString2[:b.len2+1]} {
+		buf.WriteByte(byte(len(s) - 1))
+		buf.Write(s)
+	}
+}
+
+// readHashStrings restores into b the hash strings written by writeHashStrings.
+func readHashStrings(r *bytes.Reader, b *blockState) error {
+	for _, p := range []struct {
+		hashString []byte
+		n          *int
+	}{
+		{b.hashString1[:], &b.len1},
+		{b.hashString2[:], &b.len2},
+	} {
+		n, err := r.ReadByte()
+		if err != nil || int(n) >= len(p.hashString) {
+			return ErrInvalidState
+		}
+		if _, err := io.ReadFull(r, p.hashString[:n+1]); err != nil {
+			return ErrInvalidState
+		}
+		*p.n = int(n)
+	}
+	return nil
+}
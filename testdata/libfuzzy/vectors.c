@@ -0,0 +1,66 @@
+/*
+ * vectors prints the hashes libfuzzy computes for the inputs of TestLibfuzzyVectors,
+ * one vector per line: kind size zeros elimseq hash. The input is size bytes of the
+ * given kind followed by zeros zero bytes, which clear the rolling hash from 7 on, and
+ * elimseq tells whether FUZZY_FLAG_ELIMSEQ is set.
+ *
+ * Build it against libfuzzy 2.14.1 and run it from this directory:
+ *
+ *	cc -o vectors vectors.c -lfuzzy && ./vectors > vectors.txt
+ */
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <fuzzy.h>
+
+/* input fills buf like libfuzzyInput in ssdeep_test.go. */
+static void input(unsigned char *buf, const char *kind, size_t size, size_t zeros)
+{
+	uint32_t x = 1;
+	size_t i;
+
+	for (i = 0; i < size; i++) {
+		if (strcmp(kind, "random") == 0) {
+			x = x * 1103515245u + 12345u;
+			buf[i] = (unsigned char)(x >> 16);
+		} else {
+			buf[i] = "\x01\x94\xfd"[i % 3];
+		}
+	}
+	memset(buf + size, 0, zeros);
+}
+
+int main(void)
+{
+	static const char *kinds[] = {"random", "repeat"};
+	static const size_t sizes[] = {0, 100, 4096, 10000, 65536, 300001, 3 * 1024 * 1024};
+	static const size_t zeros[] = {0, 1, 7, 16, 4096};
+	char result[FUZZY_MAX_RESULT];
+	size_t k, s, z;
+	int elimseq;
+
+	for (k = 0; k < sizeof(kinds) / sizeof(kinds[0]); k++) {
+		for (s = 0; s < sizeof(sizes) / sizeof(sizes[0]); s++) {
+			for (z = 0; z < sizeof(zeros) / sizeof(zeros[0]); z++) {
+				size_t n = sizes[s] + zeros[z];
+				unsigned char *buf = malloc(n + 1);
+
+				if (buf == NULL)
+					return 1;
+				input(buf, kinds[k], sizes[s], zeros[z]);
+				for (elimseq = 0; elimseq <= 1; elimseq++) {
+					struct fuzzy_state *state = fuzzy_new();
+
+					if (state == NULL || fuzzy_update(state, buf, n) != 0 ||
+					    fuzzy_digest(state, result, elimseq ? FUZZY_FLAG_ELIMSEQ : 0) != 0)
+						return 1;
+					fuzzy_free(state);
+					printf("%s %zu %zu %d %s\n", kinds[k], sizes[s], zeros[z], elimseq, result);
+				}
+				free(buf);
+			}
+		}
+	}
+	return 0;
+}